@@ -17,17 +17,41 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/TheLickIn13Keys/omi-webapp/internal/actions"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/archive"
 	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/calendar"
 	"github.com/TheLickIn13Keys/omi-webapp/internal/conversations"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/embeddings"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/export"
 	"github.com/TheLickIn13Keys/omi-webapp/internal/gcp"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/importer"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/jobs"
 	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/people"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/pipeline"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/prompts"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/revisions"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/trash"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/usage"
 )
 
 var (
-	client                   *mongo.Client
-	conversationsCollection  *mongo.Collection
-	usersCollection          *mongo.Collection
-	gcpCredentialsCollection *mongo.Collection
+	client                      *mongo.Client
+	conversationsCollection     *mongo.Collection
+	usersCollection             *mongo.Collection
+	gcpCredentialsCollection    *mongo.Collection
+	transcriptionJobsCollection *mongo.Collection
+	promptsCollection           *mongo.Collection
+	usageRecordsCollection      *mongo.Collection
+	usageQuotasCollection       *mongo.Collection
+	revisionsCollection         *mongo.Collection
+	peopleCollection            *mongo.Collection
+	archivesCollection          *mongo.Collection
+	chunksCollection            *mongo.Collection
+	actionItemsCollection       *mongo.Collection
+	meetingsCollection          *mongo.Collection
+	calendarFeedsCollection     *mongo.Collection
 )
 
 func main() {
@@ -42,28 +66,123 @@ func main() {
 	conversationsCollection = client.Database("omi_friend").Collection("conversations")
 	usersCollection = client.Database("omi_friend").Collection("users")
 	gcpCredentialsCollection = client.Database("omi_friend").Collection("gcp_credentials")
+	transcriptionJobsCollection = client.Database("omi_friend").Collection("transcription_jobs")
+	promptsCollection = client.Database("omi_friend").Collection("prompts")
+	usageRecordsCollection = client.Database("omi_friend").Collection("usage_records")
+	usageQuotasCollection = client.Database("omi_friend").Collection("usage_quotas")
+	revisionsCollection = client.Database("omi_friend").Collection("transcript_revisions")
+	peopleCollection = client.Database("omi_friend").Collection("people")
+	archivesCollection = client.Database("omi_friend").Collection("archive_exports")
+	chunksCollection = client.Database("omi_friend").Collection("transcript_chunks")
+	actionItemsCollection = client.Database("omi_friend").Collection("action_items")
+	meetingsCollection = client.Database("omi_friend").Collection("meetings")
+	calendarFeedsCollection = client.Database("omi_friend").Collection("calendar_feeds")
+
+	if err := conversations.EnsureIndexes(ctx, conversationsCollection); err != nil {
+		log.Fatal(err)
+	}
+	if err := prompts.EnsureIndexes(ctx, promptsCollection); err != nil {
+		log.Fatal(err)
+	}
+	if err := revisions.EnsureIndexes(ctx, revisionsCollection); err != nil {
+		log.Fatal(err)
+	}
+	if err := people.EnsureIndexes(ctx, peopleCollection, conversationsCollection); err != nil {
+		log.Fatal(err)
+	}
+	if err := embeddings.EnsureIndexes(ctx, chunksCollection); err != nil {
+		log.Fatal(err)
+	}
+	if err := actions.EnsureIndexes(ctx, conversationsCollection, actionItemsCollection); err != nil {
+		log.Fatal(err)
+	}
+	if err := calendar.EnsureIndexes(ctx, meetingsCollection, calendarFeedsCollection); err != nil {
+		log.Fatal(err)
+	}
+
+	ledger := usage.NewLedger(usageRecordsCollection, usageQuotasCollection)
+	if err := ledger.EnsureIndexes(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	queue := jobs.NewQueue(transcriptionJobsCollection, conversationsCollection, ledger)
+	if err := queue.EnsureIndexes(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	transcriber := pipeline.New(conversationsCollection, gcpCredentialsCollection, promptsCollection, revisionsCollection, queue, ledger)
+	go jobs.NewWorker(queue, transcriber.Transcribe).Run(workerCtx)
+	go archive.NewExporter(archivesCollection, conversationsCollection, peopleCollection, actionItemsCollection, meetingsCollection, gcpCredentialsCollection).Run(workerCtx)
+	go embeddings.NewIndexer(conversationsCollection, chunksCollection, gcpCredentialsCollection).Run(workerCtx)
+	go actions.NewSyncer(conversationsCollection, actionItemsCollection, meetingsCollection, peopleCollection, usersCollection).Run(workerCtx)
+	purger := trash.NewPurger(conversationsCollection, revisionsCollection, chunksCollection, actionItemsCollection, meetingsCollection, gcpCredentialsCollection)
+	go purger.Run(workerCtx)
 
 	router := mux.NewRouter()
 
 	router.HandleFunc("/register", auth.RegisterUser(usersCollection)).Methods("POST")
 	router.HandleFunc("/login", auth.LoginUser(usersCollection)).Methods("POST")
 	router.HandleFunc("/logout", auth.LogoutUser).Methods("POST")
-	router.HandleFunc("/conversations", auth.AuthMiddleware(conversations.GetConversations(conversationsCollection))).Methods("GET")
-	router.HandleFunc("/conversations/{id}", auth.AuthMiddleware(conversations.GetConversation(conversationsCollection))).Methods("GET")
+	router.HandleFunc("/conversations", auth.AuthMiddleware(conversations.GetConversations(conversationsCollection, peopleCollection))).Methods("GET")
+	router.HandleFunc("/conversations/{id}", auth.AuthMiddleware(conversations.GetConversation(conversationsCollection, peopleCollection))).Methods("GET")
 	router.HandleFunc("/conversations", auth.AuthMiddleware(conversations.CreateConversation(conversationsCollection))).Methods("POST")
-	router.HandleFunc("/conversations/{id}/messages", auth.AuthMiddleware(conversations.AddMessage(conversationsCollection))).Methods("POST")
-	router.HandleFunc("/conversations/{id}/transcript", auth.AuthMiddleware(conversations.UpdateTranscript(conversationsCollection))).Methods("PUT")
+	router.HandleFunc("/conversations/{id}", auth.AuthMiddleware(trash.UpdateConversation(conversationsCollection))).Methods("PATCH")
+	router.HandleFunc("/conversations/{id}", auth.AuthMiddleware(trash.DeleteConversation(conversationsCollection))).Methods("DELETE")
+	router.HandleFunc("/conversations/{id}/restore", auth.AuthMiddleware(trash.RestoreConversation(conversationsCollection))).Methods("POST")
+	router.HandleFunc("/conversations/{id}/purge", auth.AuthMiddleware(trash.PurgeConversation(conversationsCollection, purger))).Methods("DELETE")
+	router.HandleFunc("/conversations/{id}/messages", auth.AuthMiddleware(conversations.AddMessage(conversationsCollection, peopleCollection, gcpCredentialsCollection, queue))).Methods("POST")
+	router.HandleFunc("/conversations/{id}/messages/stream", auth.AuthMiddleware(conversations.StreamMessage(conversationsCollection, peopleCollection, gcpCredentialsCollection, queue))).Methods("POST")
+	router.HandleFunc("/conversations/{id}/transcript", auth.AuthMiddleware(conversations.UpdateTranscript(conversationsCollection, revisionsCollection))).Methods("PUT")
+	router.HandleFunc("/conversations/{id}/transcript", auth.AuthMiddleware(conversations.PatchTranscript(conversationsCollection, revisionsCollection))).Methods("PATCH")
+	router.HandleFunc("/conversations/{id}/transcript/revisions", auth.AuthMiddleware(revisions.GetRevisions(conversationsCollection, revisionsCollection))).Methods("GET")
+	router.HandleFunc("/conversations/{id}/transcript/revisions/diff", auth.AuthMiddleware(revisions.DiffRevisions(revisionsCollection))).Methods("GET")
+	router.HandleFunc("/conversations/{id}/transcript/revisions/{revision}", auth.AuthMiddleware(revisions.GetRevision(revisionsCollection))).Methods("GET")
+	router.HandleFunc("/conversations/{id}/transcript/revisions/{revision}/restore", auth.AuthMiddleware(revisions.RestoreRevision(conversationsCollection, revisionsCollection))).Methods("POST")
+	router.HandleFunc("/conversations/{id}/export", auth.AuthMiddleware(export.ExportConversation(conversationsCollection, peopleCollection))).Methods("GET")
+	router.HandleFunc("/conversations/{id}/speakers", auth.AuthMiddleware(people.AssignSpeakers(conversationsCollection, peopleCollection))).Methods("PUT")
+	router.HandleFunc("/conversations/{id}/retranscribe", auth.AuthMiddleware(conversations.Retranscribe(conversationsCollection, queue))).Methods("POST")
+	router.HandleFunc("/conversations/{id}/transcription-status", auth.AuthMiddleware(jobs.GetTranscriptionStatus(queue))).Methods("GET")
 	router.HandleFunc("/conversations/{id}/audio", auth.AuthMiddleware(gcp.GetConversationAudio(gcpCredentialsCollection, conversationsCollection))).Methods("GET")
 	router.HandleFunc("/gcp-credentials", auth.AuthMiddleware(gcp.SaveGCPCredentials(gcpCredentialsCollection))).Methods("POST")
-	router.HandleFunc("/search", auth.AuthMiddleware(conversations.GlobalSearch(conversationsCollection))).Methods("GET")
+	router.HandleFunc("/prompts", auth.AuthMiddleware(prompts.GetPrompts(promptsCollection))).Methods("GET")
+	router.HandleFunc("/prompts", auth.AuthMiddleware(prompts.CreatePrompt(promptsCollection))).Methods("POST")
+	router.HandleFunc("/prompts/{id}", auth.AuthMiddleware(prompts.UpdatePrompt(promptsCollection))).Methods("PUT")
+	router.HandleFunc("/prompts/{id}", auth.AuthMiddleware(prompts.DeletePrompt(promptsCollection))).Methods("DELETE")
+	router.HandleFunc("/people", auth.AuthMiddleware(people.GetPeople(peopleCollection))).Methods("GET")
+	router.HandleFunc("/people", auth.AuthMiddleware(people.CreatePerson(peopleCollection))).Methods("POST")
+	router.HandleFunc("/people/{id}", auth.AuthMiddleware(people.UpdatePerson(peopleCollection))).Methods("PUT")
+	router.HandleFunc("/people/{id}", auth.AuthMiddleware(people.DeletePerson(peopleCollection, conversationsCollection, actionItemsCollection))).Methods("DELETE")
+	router.HandleFunc("/people/{id}/conversations", auth.AuthMiddleware(people.GetPersonConversations(peopleCollection, conversationsCollection))).Methods("GET")
+	router.HandleFunc("/action-items", auth.AuthMiddleware(actions.GetActionItems(actionItemsCollection, conversationsCollection, peopleCollection))).Methods("GET")
+	router.HandleFunc("/action-items", auth.AuthMiddleware(actions.CreateActionItem(actionItemsCollection, conversationsCollection, peopleCollection, usersCollection))).Methods("POST")
+	router.HandleFunc("/action-items/{id}", auth.AuthMiddleware(actions.UpdateActionItem(actionItemsCollection, conversationsCollection, peopleCollection))).Methods("PATCH")
+	router.HandleFunc("/calendar/feed", auth.AuthMiddleware(calendar.GetFeed(calendarFeedsCollection, usersCollection))).Methods("GET")
+	router.HandleFunc("/calendar/time-zone", auth.AuthMiddleware(calendar.SetTimeZone(usersCollection, conversationsCollection))).Methods("PUT")
+	router.HandleFunc("/calendar/feed", auth.AuthMiddleware(calendar.DeleteFeed(calendarFeedsCollection))).Methods("DELETE")
+	router.HandleFunc("/calendar/{id}.ics", calendar.ServeFeed(calendarFeedsCollection, conversationsCollection, actionItemsCollection, meetingsCollection, peopleCollection)).Methods("GET")
+	router.HandleFunc("/archives", auth.AuthMiddleware(archive.GetArchives(archivesCollection))).Methods("GET")
+	router.HandleFunc("/archives", auth.AuthMiddleware(archive.CreateArchive(archivesCollection, gcpCredentialsCollection))).Methods("POST")
+	router.HandleFunc("/archives/{id}", auth.AuthMiddleware(archive.GetArchive(archivesCollection))).Methods("GET")
+	router.HandleFunc("/archives/{id}/download", archive.DownloadArchive(archivesCollection, gcpCredentialsCollection)).Methods("GET")
+	router.HandleFunc("/usage", auth.AuthMiddleware(usage.GetUsage(ledger))).Methods("GET")
+	router.HandleFunc("/usage/quota/{user}", auth.AuthMiddleware(usage.SetQuota(ledger, queue))).Methods("PUT")
+	router.HandleFunc("/import", auth.AuthMiddleware(importer.ImportConversations(conversationsCollection))).Methods("POST")
+	router.HandleFunc("/search", auth.AuthMiddleware(conversations.GlobalSearch(conversationsCollection, peopleCollection))).Methods("GET")
+	router.HandleFunc("/ask", auth.AuthMiddleware(conversations.Ask(conversationsCollection, peopleCollection, chunksCollection, gcpCredentialsCollection))).Methods("POST")
+	router.HandleFunc("/search/semantic", auth.AuthMiddleware(embeddings.SemanticSearch(chunksCollection, conversationsCollection, gcpCredentialsCollection))).Methods("GET")
 	router.HandleFunc("/audio/{id}/{file}", auth.AuthMiddleware(gcp.ServeAudioFile(gcpCredentialsCollection))).Methods("GET")
-	router.HandleFunc("/query-bucket", auth.AuthMiddleware(gcp.QueryBucket(gcpCredentialsCollection, conversationsCollection))).Methods("GET")
-	router.HandleFunc("/upload-audio", auth.AuthMiddleware(handleAudioUpload(gcpCredentialsCollection, conversationsCollection))).Methods("POST")
+	router.HandleFunc("/query-bucket", auth.AuthMiddleware(gcp.QueryBucket(gcpCredentialsCollection, conversationsCollection, queue))).Methods("GET")
+	router.HandleFunc("/webhooks/gladia", pipeline.GladiaWebhook(transcriber)).Methods("POST")
+	router.HandleFunc("/blobs/{user}/{bucket}/{name:.+}", gcp.ServeSignedBlob).Methods("GET")
+	router.HandleFunc("/upload-audio", auth.AuthMiddleware(handleAudioUpload(gcpCredentialsCollection, conversationsCollection, queue))).Methods("POST")
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{"Content-Disposition", "X-Next-Cursor"},
 		AllowCredentials: true,
 	})
 
@@ -73,7 +192,7 @@ func main() {
 	log.Fatal(http.ListenAndServe("0.0.0.0:8080", handler))
 }
 
-func handleAudioUpload(gcpCredentialsCollection, conversationsCollection *mongo.Collection) http.HandlerFunc {
+func handleAudioUpload(gcpCredentialsCollection, conversationsCollection *mongo.Collection, queue *jobs.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		err := r.ParseMultipartForm(10 << 20)
@@ -154,6 +273,13 @@ func handleAudioUpload(gcpCredentialsCollection, conversationsCollection *mongo.
 
 		conversation.ID = result.InsertedID.(primitive.ObjectID)
 
+		job, err := queue.Enqueue(context.TODO(), userID, conversation.ID)
+		if err != nil {
+			log.Printf("Error queuing transcription: %v", err)
+		} else {
+			conversation.TranscriptionStatus = job.State
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(conversation); err != nil {
 			log.Printf("Error encoding response: %v", err)
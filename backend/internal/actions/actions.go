@@ -0,0 +1,360 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/calendar"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/dates"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// syncBatchSize is how many conversations are synced in one sweep.
+const syncBatchSize = 100
+
+func EnsureIndexes(ctx context.Context, conversations, items *mongo.Collection) error {
+	_, err := conversations.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "needs_action_sync", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = items.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}, {Key: "due_at", Value: 1}}},
+		{Keys: bson.D{{Key: "conversation_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "assignee_id", Value: 1}}},
+	})
+	return err
+}
+
+// Syncer copies the action items extracted into each conversation to the
+// action items collection whenever a write marks it as needing a sync, so
+// that items from transcriptions, imports and restored revisions all show up
+// there. It also keeps the meetings detected in the transcript up to date.
+type Syncer struct {
+	conversations *mongo.Collection
+	items         *mongo.Collection
+	meetings      *mongo.Collection
+	people        *mongo.Collection
+	users         *mongo.Collection
+	PollInterval  time.Duration
+}
+
+func NewSyncer(conversationsCollection, itemsCollection, meetingsCollection, peopleCollection, usersCollection *mongo.Collection) *Syncer {
+	return &Syncer{
+		conversations: conversationsCollection,
+		items:         itemsCollection,
+		meetings:      meetingsCollection,
+		people:        peopleCollection,
+		users:         usersCollection,
+		PollInterval:  time.Minute,
+	}
+}
+
+// Run syncs changed conversations every PollInterval until ctx is cancelled.
+func (s *Syncer) Run(ctx context.Context) {
+	s.markUnsynced(ctx)
+	for {
+		s.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+// markUnsynced marks the conversations never synced, such as those written
+// before the action items collection existed. It runs once on start, as
+// later writes mark their conversations themselves.
+func (s *Syncer) markUnsynced(ctx context.Context) {
+	_, err := s.conversations.UpdateMany(ctx,
+		bson.M{"actions_synced_at": nil, "deleted_at": nil},
+		bson.M{"$set": bson.M{"needs_action_sync": true}},
+	)
+	if err != nil {
+		log.Printf("Error marking conversations to sync action items: %v", err)
+	}
+}
+
+func (s *Syncer) sweep(ctx context.Context) {
+	cursor, err := s.conversations.Find(ctx,
+		bson.M{"needs_action_sync": true, "deleted_at": nil},
+		options.Find().
+			SetProjection(bson.M{
+				"user_id": 1, "transcript": 1, "speakers": 1, "action_items": 1, "created_at": 1, "updated_at": 1,
+			}).
+			SetLimit(syncBatchSize),
+	)
+	if err != nil {
+		log.Printf("Error fetching conversations to sync action items: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	locations := map[primitive.ObjectID]*time.Location{}
+	for cursor.Next(ctx) {
+		var conversation models.Conversation
+		if err := cursor.Decode(&conversation); err != nil {
+			log.Printf("Error decoding conversation to sync action items: %v", err)
+			continue
+		}
+		loc, ok := locations[conversation.UserID]
+		if !ok {
+			var err error
+			if loc, err = calendar.UserLocation(ctx, s.users, conversation.UserID); err != nil {
+				log.Printf("Error loading time zone of user %s: %v", conversation.UserID.Hex(), err)
+				continue
+			}
+			locations[conversation.UserID] = loc
+		}
+		if err := Sync(ctx, s.items, s.people, conversation, loc); err != nil {
+			log.Printf("Error syncing action items of conversation %s: %v", conversation.ID.Hex(), err)
+			continue
+		}
+		if err := calendar.SyncMeetings(ctx, s.meetings, conversation, loc); err != nil {
+			log.Printf("Error syncing meetings of conversation %s: %v", conversation.ID.Hex(), err)
+			continue
+		}
+		// A conversation changed since it was read stays marked for the
+		// next sweep.
+		_, err := s.conversations.UpdateOne(ctx,
+			bson.M{"_id": conversation.ID, "updated_at": conversation.UpdatedAt},
+			bson.M{
+				"$set":   bson.M{"actions_synced_at": conversation.UpdatedAt},
+				"$unset": bson.M{"needs_action_sync": ""},
+			},
+		)
+		if err != nil {
+			log.Printf("Error marking action items of conversation %s synced: %v", conversation.ID.Hex(), err)
+		}
+	}
+}
+
+// Sync brings the conversation's items in the action items collection in
+// line with its extracted action items. New items are linked to the
+// transcript sentence they came from, given a due date if one is mentioned
+// (read in the user's time zone loc) and assigned to a person named in them
+// or else to the speaker who said them. Items that are no longer extracted are removed while still open;
+// done and dismissed items are kept, as are items added by hand.
+func Sync(ctx context.Context, items, peopleCollection *mongo.Collection, conversation models.Conversation, loc *time.Location) error {
+	var existing []models.ActionItem
+	cursor, err := items.Find(ctx, bson.M{
+		"conversation_id": conversation.ID,
+		"source":          models.ActionItemSourceConversation,
+	})
+	if err != nil {
+		return fmt.Errorf("error fetching action items: %v", err)
+	}
+	if err := cursor.All(ctx, &existing); err != nil {
+		return fmt.Errorf("error fetching action items: %v", err)
+	}
+	bySource := map[string]models.ActionItem{}
+	for _, item := range existing {
+		bySource[item.SourceText] = item
+	}
+
+	var people []models.Person
+	now := time.Now()
+	extracted := map[string]bool{}
+	for _, text := range conversation.ActionItems {
+		text = strings.TrimSpace(text)
+		if text == "" || extracted[text] {
+			continue
+		}
+		extracted[text] = true
+		index := findSentence(conversation.Transcript, text)
+
+		if item, ok := bySource[text]; ok {
+			set, unset := bson.M{}, bson.M{}
+			link(set, unset, conversation, index)
+			update := bson.M{"$set": set}
+			if len(unset) > 0 {
+				update["$unset"] = unset
+			}
+			if _, err := items.UpdateOne(ctx, bson.M{"_id": item.ID}, update); err != nil {
+				return fmt.Errorf("error updating action item: %v", err)
+			}
+			continue
+		}
+
+		if people == nil {
+			if people, err = userPeople(ctx, peopleCollection, conversation.UserID); err != nil {
+				return err
+			}
+		}
+		item := models.ActionItem{
+			UserID:         conversation.UserID,
+			ConversationID: conversation.ID,
+			Text:           text,
+			Status:         models.ActionItemOpen,
+			Source:         models.ActionItemSourceConversation,
+			SourceText:     text,
+			AssigneeID:     assignee(conversation, people, text, index),
+			DueAt:          dueDate(conversation, text, index, loc),
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if index >= 0 {
+			sentence := conversation.Transcript[index]
+			item.SentenceIndex = &index
+			item.Start = &sentence.Start
+			item.Speaker = sentence.Speaker
+		}
+		if _, err := items.InsertOne(ctx, item); err != nil {
+			return fmt.Errorf("error saving action item: %v", err)
+		}
+	}
+
+	for _, item := range existing {
+		if !extracted[item.SourceText] && item.Status == models.ActionItemOpen {
+			if _, err := items.DeleteOne(ctx, bson.M{"_id": item.ID}); err != nil {
+				return fmt.Errorf("error deleting action item: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// link sets the sentence an item came from in an update, as its position
+// can change when the transcript is edited.
+func link(set, unset bson.M, conversation models.Conversation, index int) {
+	if index < 0 {
+		unset["sentence_index"] = ""
+		unset["start"] = ""
+		unset["speaker"] = ""
+		return
+	}
+	sentence := conversation.Transcript[index]
+	set["sentence_index"] = index
+	set["start"] = sentence.Start
+	set["speaker"] = sentence.Speaker
+}
+
+func userPeople(ctx context.Context, peopleCollection *mongo.Collection, userID primitive.ObjectID) ([]models.Person, error) {
+	people := []models.Person{}
+	cursor, err := peopleCollection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching people: %v", err)
+	}
+	if err := cursor.All(ctx, &people); err != nil {
+		return nil, fmt.Errorf("error fetching people: %v", err)
+	}
+	return people, nil
+}
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}']+`)
+
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true,
+	"you": true, "your": true, "are": true, "was": true, "will": true, "about": true,
+	"from": true, "have": true, "has": true, "our": true, "can": true, "should": true,
+}
+
+// keywords returns the distinct lowercased words of text that say something
+// about its subject.
+func keywords(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, word := range wordPattern.FindAllString(strings.ToLower(text), -1) {
+		if len(word) > 2 && !stopWords[word] {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// findSentence returns the index of the transcript sentence sharing the most
+// keywords with the action item, or -1 when none shares enough of them.
+// Extracted items paraphrase what was said, so an exact match is rare.
+func findSentence(transcript []models.TranscriptionSentence, text string) int {
+	item := keywords(text)
+	required := 2
+	if len(item) < required {
+		required = len(item)
+	}
+	best, bestOverlap := -1, 0
+	for i, sentence := range transcript {
+		overlap := 0
+		for word := range keywords(sentence.Sentence) {
+			if item[word] {
+				overlap++
+			}
+		}
+		if overlap > bestOverlap {
+			best, bestOverlap = i, overlap
+		}
+	}
+	if bestOverlap == 0 || bestOverlap < required {
+		return -1
+	}
+	return best
+}
+
+// assignee returns the person an item is for: someone from the user's people
+// named in it, or else the person assigned to the speaker of its sentence.
+func assignee(conversation models.Conversation, people []models.Person, text string, index int) *primitive.ObjectID {
+	if person, ok := namedPerson(people, text); ok {
+		return &person.ID
+	}
+	if index < 0 {
+		return nil
+	}
+	label := conversation.Transcript[index].Speaker
+	for _, speaker := range conversation.Speakers {
+		if speaker.Label == label {
+			id := speaker.PersonID
+			return &id
+		}
+	}
+	return nil
+}
+
+// namedPerson finds the person whose full name appears in text or, failing
+// that, the only person whose first name does.
+func namedPerson(people []models.Person, text string) (models.Person, bool) {
+	words := " " + strings.Join(wordPattern.FindAllString(strings.ToLower(text), -1), " ") + " "
+	mentions := func(name string) bool {
+		name = strings.Join(wordPattern.FindAllString(strings.ToLower(name), -1), " ")
+		return name != "" && strings.Contains(words, " "+name+" ")
+	}
+
+	var byFirstName []models.Person
+	for _, person := range people {
+		if mentions(person.Name) {
+			return person, true
+		}
+		if first := strings.Fields(person.Name); len(first) > 1 && mentions(first[0]) {
+			byFirstName = append(byFirstName, person)
+		}
+	}
+	if len(byFirstName) == 1 {
+		return byFirstName[0], true
+	}
+	return models.Person{}, false
+}
+
+// dueDate returns the date mentioned in the item or, failing that, in the
+// sentence it came from, counting from when the conversation took place in
+// the time zone loc.
+func dueDate(conversation models.Conversation, text string, index int, loc *time.Location) *time.Time {
+	said := conversation.CreatedAt.In(loc)
+	if day, ok := dates.FindDay(text, said); ok {
+		return &day.Date
+	}
+	if index >= 0 {
+		if day, ok := dates.FindDay(conversation.Transcript[index].Sentence, said); ok {
+			return &day.Date
+		}
+	}
+	return nil
+}
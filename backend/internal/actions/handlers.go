@@ -0,0 +1,427 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/calendar"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/dates"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	defaultActionItems = 100
+	maxActionItems     = 500
+)
+
+var statuses = map[string]bool{
+	models.ActionItemOpen:      true,
+	models.ActionItemDone:      true,
+	models.ActionItemDismissed: true,
+}
+
+// GetActionItems lists the user's action items across conversations, those
+// with the soonest due date first and those without one last. Items of
+// conversations in the trash are left out. Filters:
+//
+//	status        open, done or dismissed; several may be comma-separated
+//	assignee      a person's ID or name, or "none" for unassigned items
+//	conversation  a conversation ID
+//	due_from      due on or after a date (YYYY-MM-DD)
+//	due_to        due on or before a date
+//	limit         at most this many items (default 100, up to 500)
+func GetActionItems(itemsCollection, conversationsCollection, peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query()
+
+		filter := bson.M{"user_id": userID}
+		if value := query.Get("status"); value != "" {
+			var wanted []string
+			for _, status := range strings.Split(value, ",") {
+				status = strings.TrimSpace(status)
+				if !statuses[status] {
+					http.Error(w, "Invalid status", http.StatusBadRequest)
+					return
+				}
+				wanted = append(wanted, status)
+			}
+			filter["status"] = bson.M{"$in": wanted}
+		}
+		if value := query.Get("assignee"); value == "none" {
+			filter["assignee_id"] = nil
+		} else if value != "" {
+			personID, err := findPerson(peopleCollection, userID, value)
+			if err == mongo.ErrNoDocuments {
+				json.NewEncoder(w).Encode([]models.ActionItem{})
+				return
+			}
+			if err != nil {
+				http.Error(w, "Error fetching person", http.StatusInternalServerError)
+				return
+			}
+			filter["assignee_id"] = personID
+		}
+
+		trashed, err := conversationsCollection.Distinct(context.TODO(), "_id", bson.M{"user_id": userID, "deleted_at": bson.M{"$ne": nil}})
+		if err != nil {
+			http.Error(w, "Error fetching action items", http.StatusInternalServerError)
+			return
+		}
+		conversationFilter := bson.M{"$nin": append(bson.A{}, trashed...)}
+		if value := query.Get("conversation"); value != "" {
+			conversationID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				http.Error(w, "Invalid conversation", http.StatusBadRequest)
+				return
+			}
+			conversationFilter["$eq"] = conversationID
+		}
+		filter["conversation_id"] = conversationFilter
+
+		due := bson.M{}
+		for param, op := range map[string]string{"due_from": "$gte", "due_to": "$lte"} {
+			value := query.Get(param)
+			if value == "" {
+				continue
+			}
+			t, err := parseDay(value)
+			if err != nil {
+				http.Error(w, "Invalid "+param, http.StatusBadRequest)
+				return
+			}
+			due[op] = t
+		}
+		if len(due) > 0 {
+			filter["due_at"] = due
+		}
+
+		limit := defaultActionItems
+		if value := query.Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxActionItems {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Sorting ascending on due_at alone would put items without a due
+		// date first.
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: filter}},
+			{{Key: "$addFields", Value: bson.M{"undated": bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$due_at", false}}, 0, 1}}}}},
+			{{Key: "$sort", Value: bson.D{{Key: "undated", Value: 1}, {Key: "due_at", Value: 1}, {Key: "created_at", Value: -1}}}},
+			{{Key: "$limit", Value: limit}},
+		}
+		cursor, err := itemsCollection.Aggregate(context.TODO(), pipeline)
+		if err != nil {
+			log.Printf("Error fetching action items: %v", err)
+			http.Error(w, "Error fetching action items", http.StatusInternalServerError)
+			return
+		}
+		items := []models.ActionItem{}
+		if err := cursor.All(context.TODO(), &items); err != nil {
+			http.Error(w, "Error decoding action items", http.StatusInternalServerError)
+			return
+		}
+
+		if err := resolve(context.TODO(), conversationsCollection, peopleCollection, userID, items); err != nil {
+			log.Printf("Error resolving action items: %v", err)
+		}
+		json.NewEncoder(w).Encode(items)
+	}
+}
+
+// CreateActionItem adds an action item by hand to one of the user's
+// conversations. Without a due_at, a date mentioned in the text is used,
+// read in the user's time zone.
+func CreateActionItem(itemsCollection, conversationsCollection, peopleCollection, usersCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			ConversationID primitive.ObjectID  `json:"conversation_id"`
+			Text           string              `json:"text"`
+			AssigneeID     *primitive.ObjectID `json:"assignee_id"`
+			DueAt          string              `json:"due_at"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		request.Text = strings.TrimSpace(request.Text)
+		if request.Text == "" {
+			http.Error(w, "Text is required", http.StatusBadRequest)
+			return
+		}
+
+		count, err := conversationsCollection.CountDocuments(context.TODO(), bson.M{"_id": request.ConversationID, "user_id": userID, "deleted_at": nil})
+		if err != nil {
+			http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
+			return
+		}
+		if count == 0 {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		if request.AssigneeID != nil && !personExists(w, peopleCollection, userID, *request.AssigneeID) {
+			return
+		}
+
+		now := time.Now()
+		item := models.ActionItem{
+			UserID:         userID,
+			ConversationID: request.ConversationID,
+			Text:           request.Text,
+			Status:         models.ActionItemOpen,
+			Source:         models.ActionItemSourceManual,
+			AssigneeID:     request.AssigneeID,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if request.DueAt != "" {
+			t, err := parseDay(request.DueAt)
+			if err != nil {
+				http.Error(w, "Invalid due_at", http.StatusBadRequest)
+				return
+			}
+			item.DueAt = &t
+		} else {
+			loc, err := calendar.UserLocation(context.TODO(), usersCollection, userID)
+			if err != nil {
+				log.Printf("Error loading time zone of user %s: %v", userID.Hex(), err)
+			}
+			if day, ok := dates.FindDay(request.Text, now.In(loc)); ok {
+				item.DueAt = &day.Date
+			}
+		}
+
+		result, err := itemsCollection.InsertOne(context.TODO(), item)
+		if err != nil {
+			http.Error(w, "Error creating action item", http.StatusInternalServerError)
+			return
+		}
+		item.ID = result.InsertedID.(primitive.ObjectID)
+
+		items := []models.ActionItem{item}
+		if err := resolve(context.TODO(), conversationsCollection, peopleCollection, userID, items); err != nil {
+			log.Printf("Error resolving action item: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(items[0])
+	}
+}
+
+// UpdateActionItem changes an action item's text, status, assignee or due
+// date. A null assignee_id or due_at clears it.
+func UpdateActionItem(itemsCollection, conversationsCollection, peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		itemID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		set, unset := bson.M{"updated_at": now}, bson.M{}
+		if raw, ok := request["text"]; ok {
+			var text string
+			if err := json.Unmarshal(raw, &text); err != nil || strings.TrimSpace(text) == "" {
+				http.Error(w, "Invalid text", http.StatusBadRequest)
+				return
+			}
+			set["text"] = strings.TrimSpace(text)
+		}
+		if raw, ok := request["status"]; ok {
+			var status string
+			if err := json.Unmarshal(raw, &status); err != nil || !statuses[status] {
+				http.Error(w, "Invalid status", http.StatusBadRequest)
+				return
+			}
+			set["status"] = status
+			if status == models.ActionItemDone {
+				set["completed_at"] = now
+			} else {
+				unset["completed_at"] = ""
+			}
+		}
+		if raw, ok := request["assignee_id"]; ok {
+			var assigneeID *primitive.ObjectID
+			if err := json.Unmarshal(raw, &assigneeID); err != nil {
+				http.Error(w, "Invalid assignee_id", http.StatusBadRequest)
+				return
+			}
+			if assigneeID == nil {
+				unset["assignee_id"] = ""
+			} else if !personExists(w, peopleCollection, userID, *assigneeID) {
+				return
+			} else {
+				set["assignee_id"] = *assigneeID
+			}
+		}
+		if raw, ok := request["due_at"]; ok {
+			var dueAt *string
+			if err := json.Unmarshal(raw, &dueAt); err != nil {
+				http.Error(w, "Invalid due_at", http.StatusBadRequest)
+				return
+			}
+			if dueAt == nil {
+				unset["due_at"] = ""
+			} else {
+				t, err := parseDay(*dueAt)
+				if err != nil {
+					http.Error(w, "Invalid due_at", http.StatusBadRequest)
+					return
+				}
+				set["due_at"] = t
+			}
+		}
+
+		update := bson.M{"$set": set}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		var item models.ActionItem
+		err = itemsCollection.FindOneAndUpdate(context.TODO(),
+			bson.M{"_id": itemID, "user_id": userID},
+			update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&item)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Action item not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error updating action item", http.StatusInternalServerError)
+			return
+		}
+
+		items := []models.ActionItem{item}
+		if err := resolve(context.TODO(), conversationsCollection, peopleCollection, userID, items); err != nil {
+			log.Printf("Error resolving action item: %v", err)
+		}
+		json.NewEncoder(w).Encode(items[0])
+	}
+}
+
+// resolve fills in the names of the items' conversations and assignees.
+func resolve(ctx context.Context, conversationsCollection, peopleCollection *mongo.Collection, userID primitive.ObjectID, items []models.ActionItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	var conversationIDs, personIDs []primitive.ObjectID
+	for _, item := range items {
+		conversationIDs = append(conversationIDs, item.ConversationID)
+		if item.AssigneeID != nil {
+			personIDs = append(personIDs, *item.AssigneeID)
+		}
+	}
+
+	var conversations []models.Conversation
+	cursor, err := conversationsCollection.Find(ctx,
+		bson.M{"_id": bson.M{"$in": conversationIDs}, "user_id": userID},
+		options.Find().SetProjection(bson.M{"name": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &conversations); err != nil {
+		return err
+	}
+	conversationNames := map[primitive.ObjectID]string{}
+	for _, conversation := range conversations {
+		conversationNames[conversation.ID] = conversation.Name
+	}
+
+	personNames := map[primitive.ObjectID]string{}
+	if len(personIDs) > 0 {
+		var people []models.Person
+		cursor, err := peopleCollection.Find(ctx, bson.M{"_id": bson.M{"$in": personIDs}, "user_id": userID})
+		if err != nil {
+			return err
+		}
+		if err := cursor.All(ctx, &people); err != nil {
+			return err
+		}
+		for _, person := range people {
+			personNames[person.ID] = person.Name
+		}
+	}
+
+	for i, item := range items {
+		items[i].ConversationName = conversationNames[item.ConversationID]
+		if item.AssigneeID != nil {
+			items[i].AssigneeName = personNames[*item.AssigneeID]
+		}
+	}
+	return nil
+}
+
+// personExists reports whether the person is one of the user's people,
+// writing an error response when not.
+func personExists(w http.ResponseWriter, peopleCollection *mongo.Collection, userID, personID primitive.ObjectID) bool {
+	count, err := peopleCollection.CountDocuments(context.TODO(), bson.M{"_id": personID, "user_id": userID})
+	if err != nil {
+		http.Error(w, "Error fetching person", http.StatusInternalServerError)
+		return false
+	}
+	if count == 0 {
+		http.Error(w, "Assignee not found", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func findPerson(peopleCollection *mongo.Collection, userID primitive.ObjectID, assignee string) (primitive.ObjectID, error) {
+	filter := bson.M{"user_id": userID, "name": assignee}
+	if id, err := primitive.ObjectIDFromHex(assignee); err == nil {
+		filter = bson.M{"user_id": userID, "_id": id}
+	}
+	var person models.Person
+	err := peopleCollection.FindOne(context.TODO(), filter).Decode(&person)
+	return person.ID, err
+}
+
+// parseDay accepts a YYYY-MM-DD date or an RFC 3339 time, keeping only its
+// date.
+func parseDay(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
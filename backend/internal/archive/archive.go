@@ -0,0 +1,360 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/export"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/gcp"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/people"
+)
+
+const (
+	maxAttempts = 3
+	// retention is how long a finished archive can be downloaded.
+	retention = 7 * 24 * time.Hour
+)
+
+// Exporter builds archive exports in the background. Exports are leased from
+// Mongo like transcription jobs, so one interrupted by a restart is picked up
+// again.
+type Exporter struct {
+	archives      *mongo.Collection
+	conversations *mongo.Collection
+	people        *mongo.Collection
+	actionItems   *mongo.Collection
+	meetings      *mongo.Collection
+	credentials   *mongo.Collection
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+}
+
+func NewExporter(archivesCollection, conversationsCollection, peopleCollection, actionItemsCollection, meetingsCollection, gcpCredentialsCollection *mongo.Collection) *Exporter {
+	return &Exporter{
+		archives:      archivesCollection,
+		conversations: conversationsCollection,
+		people:        peopleCollection,
+		actionItems:   actionItemsCollection,
+		meetings:      meetingsCollection,
+		credentials:   gcpCredentialsCollection,
+		PollInterval:  5 * time.Second,
+		LeaseDuration: time.Hour,
+	}
+}
+
+// archiveObject is the name finished archives are stored under in the
+// user's storage, so that any server instance can hand them out.
+func archiveObject(archive *models.ArchiveExport) string {
+	return gcp.ArchivePrefix + archive.ID.Hex() + ".zip"
+}
+
+// Run builds queued archives and removes expired ones until ctx is cancelled.
+func (e *Exporter) Run(ctx context.Context) {
+	for {
+		archive, err := e.lease(ctx)
+		if err != nil {
+			log.Printf("Error leasing archive export: %v", err)
+		}
+		if archive == nil {
+			e.expire(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.PollInterval):
+			}
+			continue
+		}
+		e.runExport(ctx, archive)
+	}
+}
+
+// lease claims the oldest queued archive, or one whose builder died.
+func (e *Exporter) lease(ctx context.Context) (*models.ArchiveExport, error) {
+	now := time.Now()
+	leaseExpiresAt := now.Add(e.LeaseDuration)
+	var archive models.ArchiveExport
+	err := e.archives.FindOneAndUpdate(ctx,
+		bson.M{"$or": []bson.M{
+			{"state": models.JobQueued},
+			{"state": models.JobRunning, "lease_expires_at": bson.M{"$lt": now}},
+		}},
+		bson.M{
+			"$set": bson.M{"state": models.JobRunning, "lease_expires_at": leaseExpiresAt, "updated_at": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&archive)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+func (e *Exporter) runExport(ctx context.Context, archive *models.ArchiveExport) {
+	buildCtx, cancel := context.WithTimeout(ctx, e.LeaseDuration-time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	set := bson.M{"updated_at": now}
+	unset := bson.M{"lease_expires_at": ""}
+	count, size, err := e.build(buildCtx, archive)
+	switch {
+	case err == nil:
+		expiresAt := now.Add(retention)
+		set["state"] = models.JobSucceeded
+		set["conversations"] = count
+		set["size"] = size
+		set["finished_at"] = now
+		set["expires_at"] = expiresAt
+		unset["last_error"] = ""
+	case archive.Attempts >= maxAttempts:
+		log.Printf("Archive export %s failed: %v", archive.ID.Hex(), err)
+		set["state"] = models.JobFailed
+		set["last_error"] = err.Error()
+		set["finished_at"] = now
+	default:
+		log.Printf("Archive export %s failed (attempt %d/%d): %v", archive.ID.Hex(), archive.Attempts, maxAttempts, err)
+		set["state"] = models.JobQueued
+		set["last_error"] = err.Error()
+	}
+
+	_, err = e.archives.UpdateOne(ctx, bson.M{"_id": archive.ID}, bson.M{"$set": set, "$unset": unset})
+	if err != nil {
+		log.Printf("Error updating archive export %s: %v", archive.ID.Hex(), err)
+	}
+}
+
+// expire deletes archives past their retention from the users' storage.
+func (e *Exporter) expire(ctx context.Context) {
+	cursor, err := e.archives.Find(ctx, bson.M{"state": models.JobSucceeded, "expires_at": bson.M{"$lt": time.Now()}})
+	if err != nil {
+		log.Printf("Error fetching expired archives: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var archive models.ArchiveExport
+		if err := cursor.Decode(&archive); err != nil {
+			log.Printf("Error decoding archive export: %v", err)
+			continue
+		}
+		if err := e.remove(ctx, &archive); err != nil {
+			log.Printf("Error removing archive %s: %v", archive.ID.Hex(), err)
+			continue
+		}
+		_, err := e.archives.UpdateOne(ctx, bson.M{"_id": archive.ID}, bson.M{"$set": bson.M{"state": models.ArchiveExpired, "updated_at": time.Now()}})
+		if err != nil {
+			log.Printf("Error expiring archive %s: %v", archive.ID.Hex(), err)
+		}
+	}
+}
+
+func (e *Exporter) remove(ctx context.Context, archive *models.ArchiveExport) error {
+	store, _, err := gcp.OpenUserBlobStore(ctx, e.credentials, archive.UserID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Without storage credentials there is nothing left to reach.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := store.Delete(ctx, archiveObject(archive)); err != nil && !errors.Is(err, gcp.ErrObjectNotFound) {
+		return err
+	}
+	return nil
+}
+
+// manifest describes an archive's contents.
+type manifest struct {
+	UserID        string    `json:"user_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Conversations int       `json:"conversations"`
+	IncludeAudio  bool      `json:"include_audio"`
+	AudioErrors   []string  `json:"audio_errors,omitempty"`
+}
+
+// build writes the archive to a temporary file and uploads it to the user's
+// storage once complete. It returns the number of conversations and the
+// archive size.
+func (e *Exporter) build(ctx context.Context, archive *models.ArchiveExport) (int, int64, error) {
+	store, _, err := gcp.OpenUserBlobStore(ctx, e.credentials, archive.UserID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("storage unavailable: %v", err)
+	}
+	defer store.Close()
+
+	file, err := os.CreateTemp("", "omi-archive-*.zip")
+	if err != nil {
+		return 0, 0, fmt.Errorf("error creating archive file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	info := manifest{UserID: archive.UserID.Hex(), CreatedAt: time.Now(), IncludeAudio: archive.IncludeAudio}
+	zipWriter := zip.NewWriter(file)
+
+	cursor, err := e.conversations.Find(ctx, bson.M{"user_id": archive.UserID, "deleted_at": nil}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return 0, 0, fmt.Errorf("error fetching conversations: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var conversationIDs []primitive.ObjectID
+	conversationNames := map[primitive.ObjectID]string{}
+	for cursor.Next(ctx) {
+		var conversation models.Conversation
+		if err := cursor.Decode(&conversation); err != nil {
+			return 0, 0, fmt.Errorf("error decoding conversation: %v", err)
+		}
+		if err := people.Resolve(ctx, e.people, &conversation); err != nil {
+			return 0, 0, fmt.Errorf("error resolving speaker names: %v", err)
+		}
+
+		dir := "conversations/" + conversation.ID.Hex()
+		for _, format := range []string{export.FormatJSON, export.FormatMarkdown} {
+			if err := writeEntry(zipWriter, dir+"/conversation."+export.Formats[format].Extension, func(w io.Writer) error {
+				return export.Render(w, conversation, format)
+			}); err != nil {
+				return 0, 0, err
+			}
+		}
+		if err := writeJSON(zipWriter, dir+"/chat.json", conversation.ChatHistory); err != nil {
+			return 0, 0, err
+		}
+		conversationIDs = append(conversationIDs, conversation.ID)
+		conversationNames[conversation.ID] = conversation.Name
+
+		if archive.IncludeAudio && conversation.AudioFile != nil {
+			if err := copyAudio(ctx, zipWriter, store, dir, conversation.AudioFile.Name); err != nil {
+				info.AudioErrors = append(info.AudioErrors, fmt.Sprintf("%s: %v", conversation.AudioFile.Name, err))
+			}
+		}
+		info.Conversations++
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error fetching conversations: %v", err)
+	}
+
+	var directory []models.Person
+	peopleCursor, err := e.people.Find(ctx, bson.M{"user_id": archive.UserID})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error fetching people: %v", err)
+	}
+	if err := peopleCursor.All(ctx, &directory); err != nil {
+		return 0, 0, fmt.Errorf("error fetching people: %v", err)
+	}
+
+	if err := writeJSON(zipWriter, "people.json", directory); err != nil {
+		return 0, 0, err
+	}
+
+	// Action items and meetings of conversations in the trash are left out
+	// along with the conversations.
+	actionItems := []models.ActionItem{}
+	meetings := []models.Meeting{}
+	if len(conversationIDs) > 0 {
+		itemsCursor, err := e.actionItems.Find(ctx,
+			bson.M{"user_id": archive.UserID, "conversation_id": bson.M{"$in": conversationIDs}},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+		)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error fetching action items: %v", err)
+		}
+		if err := itemsCursor.All(ctx, &actionItems); err != nil {
+			return 0, 0, fmt.Errorf("error fetching action items: %v", err)
+		}
+		for i, item := range actionItems {
+			actionItems[i].ConversationName = conversationNames[item.ConversationID]
+		}
+
+		meetingsCursor, err := e.meetings.Find(ctx,
+			bson.M{"user_id": archive.UserID, "conversation_id": bson.M{"$in": conversationIDs}},
+			options.Find().SetSort(bson.D{{Key: "start", Value: 1}}),
+		)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error fetching meetings: %v", err)
+		}
+		if err := meetingsCursor.All(ctx, &meetings); err != nil {
+			return 0, 0, fmt.Errorf("error fetching meetings: %v", err)
+		}
+	}
+	if err := writeJSON(zipWriter, "action_items.json", actionItems); err != nil {
+		return 0, 0, err
+	}
+	if err := writeJSON(zipWriter, "meetings.json", meetings); err != nil {
+		return 0, 0, err
+	}
+	if err := writeJSON(zipWriter, "manifest.json", info); err != nil {
+		return 0, 0, err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return 0, 0, fmt.Errorf("error writing archive: %v", err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error writing archive: %v", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, fmt.Errorf("error writing archive: %v", err)
+	}
+	if err := store.Put(ctx, archiveObject(archive), file, "application/zip"); err != nil {
+		return 0, 0, fmt.Errorf("error saving archive: %v", err)
+	}
+	return info.Conversations, stat.Size(), nil
+}
+
+func writeEntry(zipWriter *zip.Writer, name string, write func(w io.Writer) error) error {
+	w, err := zipWriter.Create(name)
+	if err != nil {
+		return fmt.Errorf("error adding %s to archive: %v", name, err)
+	}
+	if err := write(w); err != nil {
+		return fmt.Errorf("error adding %s to archive: %v", name, err)
+	}
+	return nil
+}
+
+func writeJSON(zipWriter *zip.Writer, name string, value interface{}) error {
+	return writeEntry(zipWriter, name, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	})
+}
+
+// copyAudio stores an audio object uncompressed, as audio formats are
+// already compressed.
+func copyAudio(ctx context.Context, zipWriter *zip.Writer, store gcp.BlobStore, dir, name string) error {
+	reader, err := store.Open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	w, err := zipWriter.CreateHeader(&zip.FileHeader{Name: dir + "/audio/" + path.Base(name), Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, reader)
+	return err
+}
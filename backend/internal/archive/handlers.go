@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/gcp"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// downloadLinkTTL is how long a download link handed to the client works.
+const downloadLinkTTL = time.Hour
+
+func signArchive(id, expires string) string {
+	mac := hmac.New(sha256.New, models.JWTSecret)
+	mac.Write([]byte("archive\n" + id + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// withDownloadURL sets a signed download link on a finished archive.
+func withDownloadURL(archive *models.ArchiveExport) {
+	if archive.State != models.JobSucceeded {
+		return
+	}
+	expires := strconv.FormatInt(time.Now().Add(downloadLinkTTL).Unix(), 10)
+	query := url.Values{"expires": {expires}, "signature": {signArchive(archive.ID.Hex(), expires)}}
+	archive.DownloadURL = fmt.Sprintf("%s/archives/%s/download?%s", gcp.PublicBaseURL(), archive.ID.Hex(), query.Encode())
+}
+
+// CreateArchive queues an export of all of the user's data. Only one export
+// per user can be pending at a time, and the user needs storage to keep it
+// in.
+func CreateArchive(archivesCollection, gcpCredentialsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			IncludeAudio bool `json:"include_audio"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		hasStorage, err := gcpCredentialsCollection.CountDocuments(context.TODO(), bson.M{"user_id": userID})
+		if err != nil {
+			http.Error(w, "Error creating archive", http.StatusInternalServerError)
+			return
+		}
+		if hasStorage == 0 {
+			http.Error(w, "Storage credentials are required to keep archives", http.StatusBadRequest)
+			return
+		}
+
+		pending, err := archivesCollection.CountDocuments(context.TODO(), bson.M{
+			"user_id": userID,
+			"state":   bson.M{"$in": []string{models.JobQueued, models.JobRunning}},
+		})
+		if err != nil {
+			http.Error(w, "Error creating archive", http.StatusInternalServerError)
+			return
+		}
+		if pending > 0 {
+			http.Error(w, "An archive is already being prepared", http.StatusConflict)
+			return
+		}
+
+		archive := models.ArchiveExport{
+			UserID:       userID,
+			State:        models.JobQueued,
+			IncludeAudio: request.IncludeAudio,
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+		result, err := archivesCollection.InsertOne(context.TODO(), archive)
+		if err != nil {
+			http.Error(w, "Error creating archive", http.StatusInternalServerError)
+			return
+		}
+		archive.ID = result.InsertedID.(primitive.ObjectID)
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(archive)
+	}
+}
+
+func GetArchives(archivesCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		cursor, err := archivesCollection.Find(context.TODO(), bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		if err != nil {
+			http.Error(w, "Error fetching archives", http.StatusInternalServerError)
+			return
+		}
+		defer cursor.Close(context.TODO())
+
+		archives := []models.ArchiveExport{}
+		if err := cursor.All(context.TODO(), &archives); err != nil {
+			http.Error(w, "Error decoding archives", http.StatusInternalServerError)
+			return
+		}
+		for i := range archives {
+			withDownloadURL(&archives[i])
+		}
+		json.NewEncoder(w).Encode(archives)
+	}
+}
+
+// GetArchive returns an archive's status, with a download link once it is
+// ready.
+func GetArchive(archivesCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		archiveID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var archive models.ArchiveExport
+		err = archivesCollection.FindOne(context.TODO(), bson.M{"_id": archiveID, "user_id": userID}).Decode(&archive)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Archive not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching archive", http.StatusInternalServerError)
+			return
+		}
+		withDownloadURL(&archive)
+		json.NewEncoder(w).Encode(archive)
+	}
+}
+
+// DownloadArchive redirects holders of a link from GetArchive to a signed
+// URL for the finished archive in the user's storage.
+func DownloadArchive(archivesCollection, gcpCredentialsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		expires := r.URL.Query().Get("expires")
+		exp, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil || time.Now().Unix() > exp {
+			http.Error(w, "Link expired", http.StatusForbidden)
+			return
+		}
+		if !hmac.Equal([]byte(signArchive(params["id"], expires)), []byte(r.URL.Query().Get("signature"))) {
+			http.Error(w, "Invalid signature", http.StatusForbidden)
+			return
+		}
+
+		archiveID, _ := primitive.ObjectIDFromHex(params["id"])
+		var archive models.ArchiveExport
+		err = archivesCollection.FindOne(context.TODO(), bson.M{"_id": archiveID, "state": models.JobSucceeded}).Decode(&archive)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Archive not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching archive", http.StatusInternalServerError)
+			return
+		}
+
+		store, _, err := gcp.OpenUserBlobStore(r.Context(), gcpCredentialsCollection, archive.UserID)
+		if err != nil {
+			log.Printf("Error opening storage for archive %s: %v", archive.ID.Hex(), err)
+			http.Error(w, "Error opening archive storage", http.StatusInternalServerError)
+			return
+		}
+		defer store.Close()
+		signedURL, err := store.SignURL(r.Context(), archiveObject(&archive), downloadLinkTTL)
+		if err != nil {
+			log.Printf("Error signing archive %s: %v", archive.ID.Hex(), err)
+			http.Error(w, "Error creating download link", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, signedURL, http.StatusFound)
+	}
+}
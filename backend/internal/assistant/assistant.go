@@ -0,0 +1,100 @@
+package assistant
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/export"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/llm"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	// maxTranscriptChars keeps the prompt within the context window of
+	// common models; longer transcripts are cut off at the end.
+	maxTranscriptChars = 60000
+	// maxHistoryMessages is how many earlier chat messages are sent along.
+	maxHistoryMessages = 20
+)
+
+const systemPrompt = `You are an assistant answering questions about a recorded conversation.
+Answer only from the transcript, summary and action items below. If they do not contain the answer, say so.
+Transcript lines start with the time in the recording and the speaker. Cite the time when you refer to something said.`
+
+// Messages builds the chat completion request for a question about the
+// conversation: the conversation itself as the system prompt, then the
+// recent chat history, then the question.
+func Messages(conversation models.Conversation, question string) []llm.Message {
+	messages := []llm.Message{{Role: llm.RoleSystem, Content: systemPrompt + "\n\n" + conversationContext(conversation)}}
+
+	history := conversation.ChatHistory
+	if len(history) > maxHistoryMessages {
+		history = history[len(history)-maxHistoryMessages:]
+	}
+	for _, message := range history {
+		role := llm.RoleUser
+		if message.Role == models.ChatRoleAssistant {
+			role = llm.RoleAssistant
+		}
+		messages = append(messages, llm.Message{Role: role, Content: message.Content})
+	}
+	return append(messages, llm.Message{Role: llm.RoleUser, Content: question})
+}
+
+// Reply answers a question about the conversation. The conversation's chat
+// history should not yet include the question.
+func Reply(ctx context.Context, provider llm.Provider, conversation models.Conversation, question string) (string, error) {
+	reply, err := provider.Complete(ctx, Messages(conversation, question))
+	if err != nil {
+		return "", err
+	}
+	if reply == "" {
+		return "", fmt.Errorf("%s returned an empty reply", provider.Name())
+	}
+	return reply, nil
+}
+
+// StreamReply answers a question like Reply, passing the reply to onDelta
+// as it is generated.
+func StreamReply(ctx context.Context, provider llm.Provider, conversation models.Conversation, question string, onDelta func(string) error) (string, error) {
+	reply, err := llm.Stream(ctx, provider, Messages(conversation, question), onDelta)
+	if err != nil {
+		return "", err
+	}
+	if reply == "" {
+		return "", fmt.Errorf("%s returned an empty reply", provider.Name())
+	}
+	return reply, nil
+}
+
+func conversationContext(conversation models.Conversation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Conversation: %s\nRecorded: %s\n", conversation.Name, conversation.CreatedAt.Format("2006-01-02 15:04"))
+	if conversation.Summary != "" {
+		fmt.Fprintf(&b, "\nSummary:\n%s\n", conversation.Summary)
+	}
+	if len(conversation.ActionItems) > 0 {
+		b.WriteString("\nAction items:\n")
+		for _, item := range conversation.ActionItems {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+	}
+
+	if len(conversation.Transcript) == 0 {
+		b.WriteString("\nThe transcript is not available yet.\n")
+		return b.String()
+	}
+	b.WriteString("\nTranscript:\n")
+	written := 0
+	for _, sentence := range conversation.Transcript {
+		line := fmt.Sprintf("[%s] %s: %s\n", export.Clock(sentence.Start), export.SpeakerName(sentence), sentence.Sentence)
+		if written+len(line) > maxTranscriptChars {
+			b.WriteString("[The rest of the transcript was cut off.]\n")
+			break
+		}
+		b.WriteString(line)
+		written += len(line)
+	}
+	return b.String()
+}
@@ -87,6 +87,17 @@ func GetUserIDFromRequest(r *http.Request) (primitive.ObjectID, error) {
 	return userID, nil
 }
 
+// IsAdmin reports whether the user is listed in ADMIN_USER_IDS, a
+// comma-separated list of user IDs allowed to manage other users.
+func IsAdmin(userID primitive.ObjectID) bool {
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if strings.TrimSpace(id) == userID.Hex() {
+			return true
+		}
+	}
+	return false
+}
+
 func LoginUser(collection *mongo.Collection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
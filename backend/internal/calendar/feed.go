@@ -0,0 +1,290 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/gcp"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	// maxFeedEntries caps the action items and, separately, the meetings in
+	// a feed.
+	maxFeedEntries = 1000
+	// meetingHistory is how far back meetings stay in the feed.
+	meetingHistory = 90 * 24 * time.Hour
+)
+
+// feedToken authenticates requests for a feed. Calendar clients cannot send
+// our JWTs, so it is embedded in the feed URL.
+func feedToken(feedID primitive.ObjectID) string {
+	mac := hmac.New(sha256.New, models.JWTSecret)
+	mac.Write([]byte("calendar-feed\n" + feedID.Hex()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func withURL(feed *models.CalendarFeed) {
+	query := url.Values{"token": {feedToken(feed.ID)}}
+	feed.URL = fmt.Sprintf("%s/calendar/%s.ics?%s", gcp.PublicBaseURL(), feed.ID.Hex(), query.Encode())
+}
+
+// GetFeed returns the user's calendar feed with its subscription URL and
+// the time zone its dates are read in, creating the feed on first use.
+func GetFeed(feedsCollection, usersCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var feed models.CalendarFeed
+		err = feedsCollection.FindOneAndUpdate(context.TODO(),
+			bson.M{"user_id": userID},
+			bson.M{"$setOnInsert": models.CalendarFeed{UserID: userID, CreatedAt: time.Now()}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&feed)
+		if mongo.IsDuplicateKeyError(err) {
+			err = feedsCollection.FindOne(context.TODO(), bson.M{"user_id": userID}).Decode(&feed)
+		}
+		if err != nil {
+			http.Error(w, "Error fetching calendar feed", http.StatusInternalServerError)
+			return
+		}
+
+		withURL(&feed)
+		loc, err := UserLocation(context.TODO(), usersCollection, userID)
+		if err != nil {
+			log.Printf("Error loading time zone of user %s: %v", userID.Hex(), err)
+		}
+		feed.TimeZone = loc.String()
+		json.NewEncoder(w).Encode(feed)
+	}
+}
+
+// DeleteFeed revokes the user's calendar feed URL. The next GetFeed creates
+// a feed with a new URL.
+func DeleteFeed(feedsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		result, err := feedsCollection.DeleteOne(context.TODO(), bson.M{"user_id": userID})
+		if err != nil {
+			http.Error(w, "Error deleting calendar feed", http.StatusInternalServerError)
+			return
+		}
+		if result.DeletedCount == 0 {
+			http.Error(w, "Calendar feed not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"message": "Calendar feed deleted successfully"})
+	}
+}
+
+// ServeFeed serves a user's calendar feed to holders of its URL: action
+// items with a due date as to-dos, and meetings arranged in their
+// conversations from the last 90 days on as events. Dismissed items and
+// conversations in the trash are left out.
+func ServeFeed(feedsCollection, conversationsCollection, actionItemsCollection, meetingsCollection, peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		feedID, err := primitive.ObjectIDFromHex(params["id"])
+		if err != nil || !hmac.Equal([]byte(feedToken(feedID)), []byte(r.URL.Query().Get("token"))) {
+			http.Error(w, "Invalid token", http.StatusForbidden)
+			return
+		}
+
+		var feed models.CalendarFeed
+		err = feedsCollection.FindOne(context.TODO(), bson.M{"_id": feedID}).Decode(&feed)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Calendar feed not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching calendar feed", http.StatusInternalServerError)
+			return
+		}
+		userID := feed.UserID
+
+		trashed, err := conversationsCollection.Distinct(context.TODO(), "_id", bson.M{"user_id": userID, "deleted_at": bson.M{"$ne": nil}})
+		if err != nil {
+			http.Error(w, "Error fetching calendar", http.StatusInternalServerError)
+			return
+		}
+		notTrashed := bson.M{"$nin": append(bson.A{}, trashed...)}
+
+		var items []models.ActionItem
+		cursor, err := actionItemsCollection.Find(context.TODO(),
+			bson.M{
+				"user_id":         userID,
+				"conversation_id": notTrashed,
+				"status":          bson.M{"$in": []string{models.ActionItemOpen, models.ActionItemDone}},
+				"due_at":          bson.M{"$ne": nil},
+			},
+			options.Find().SetSort(bson.D{{Key: "due_at", Value: -1}}).SetLimit(maxFeedEntries),
+		)
+		if err == nil {
+			err = cursor.All(context.TODO(), &items)
+		}
+		if err != nil {
+			log.Printf("Error fetching action items for calendar feed %s: %v", feedID.Hex(), err)
+			http.Error(w, "Error fetching calendar", http.StatusInternalServerError)
+			return
+		}
+
+		var meetings []models.Meeting
+		cursor, err = meetingsCollection.Find(context.TODO(),
+			bson.M{
+				"user_id":         userID,
+				"conversation_id": notTrashed,
+				"start":           bson.M{"$gte": time.Now().Add(-meetingHistory)},
+			},
+			options.Find().SetSort(bson.D{{Key: "start", Value: 1}}).SetLimit(maxFeedEntries),
+		)
+		if err == nil {
+			err = cursor.All(context.TODO(), &meetings)
+		}
+		if err != nil {
+			log.Printf("Error fetching meetings for calendar feed %s: %v", feedID.Hex(), err)
+			http.Error(w, "Error fetching calendar", http.StatusInternalServerError)
+			return
+		}
+
+		conversationNames, personNames, err := names(context.TODO(), conversationsCollection, peopleCollection, userID, items, meetings)
+		if err != nil {
+			log.Printf("Error resolving names for calendar feed %s: %v", feedID.Hex(), err)
+		}
+
+		var body bytes.Buffer
+		ics := &icsWriter{w: &body}
+		ics.line("BEGIN", "VCALENDAR")
+		ics.line("VERSION", "2.0")
+		ics.line("PRODID", "-//omi-webapp//Conversations//EN")
+		ics.line("CALSCALE", "GREGORIAN")
+		ics.line("METHOD", "PUBLISH")
+		ics.text("X-WR-CALNAME", "Omi conversations")
+		ics.line("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+		ics.line("X-PUBLISHED-TTL", "PT1H")
+
+		for _, item := range items {
+			ics.line("BEGIN", "VTODO")
+			ics.line("UID", uid("action-item", item.ID.Hex()))
+			ics.utc("DTSTAMP", item.UpdatedAt)
+			ics.utc("CREATED", item.CreatedAt)
+			ics.utc("LAST-MODIFIED", item.UpdatedAt)
+			ics.text("SUMMARY", item.Text)
+			ics.date("DUE", *item.DueAt)
+			description := "From " + conversationNames[item.ConversationID]
+			if item.AssigneeID != nil && personNames[*item.AssigneeID] != "" {
+				description += "\nAssigned to " + personNames[*item.AssigneeID]
+			}
+			ics.text("DESCRIPTION", description)
+			if item.Status == models.ActionItemDone {
+				ics.line("STATUS", "COMPLETED")
+				if item.CompletedAt != nil {
+					ics.utc("COMPLETED", *item.CompletedAt)
+				}
+			} else {
+				ics.line("STATUS", "NEEDS-ACTION")
+			}
+			ics.line("END", "VTODO")
+		}
+
+		for _, meeting := range meetings {
+			ics.line("BEGIN", "VEVENT")
+			ics.line("UID", uid("meeting", meeting.ConversationID.Hex()+"-"+meeting.Key))
+			ics.utc("DTSTAMP", meeting.CreatedAt)
+			if meeting.AllDay {
+				ics.date("DTSTART", meeting.Start)
+				ics.date("DTEND", meeting.Start.AddDate(0, 0, 1))
+			} else {
+				ics.utc("DTSTART", meeting.Start)
+				ics.utc("DTEND", meeting.Start.Add(defaultMeetingLength))
+			}
+			ics.text("SUMMARY", meeting.Text)
+			ics.text("DESCRIPTION", "Mentioned in "+conversationNames[meeting.ConversationID])
+			ics.line("END", "VEVENT")
+		}
+		ics.line("END", "VCALENDAR")
+
+		if ics.err != nil {
+			http.Error(w, "Error writing calendar", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="omi.ics"`)
+		w.Write(body.Bytes())
+	}
+}
+
+// names returns the names of the conversations and assignees in the feed.
+func names(ctx context.Context, conversationsCollection, peopleCollection *mongo.Collection, userID primitive.ObjectID, items []models.ActionItem, meetings []models.Meeting) (map[primitive.ObjectID]string, map[primitive.ObjectID]string, error) {
+	conversationNames := map[primitive.ObjectID]string{}
+	personNames := map[primitive.ObjectID]string{}
+	var conversationIDs, personIDs []primitive.ObjectID
+	for _, item := range items {
+		conversationIDs = append(conversationIDs, item.ConversationID)
+		if item.AssigneeID != nil {
+			personIDs = append(personIDs, *item.AssigneeID)
+		}
+	}
+	for _, meeting := range meetings {
+		conversationIDs = append(conversationIDs, meeting.ConversationID)
+	}
+
+	if len(conversationIDs) > 0 {
+		var conversations []models.Conversation
+		cursor, err := conversationsCollection.Find(ctx,
+			bson.M{"_id": bson.M{"$in": conversationIDs}, "user_id": userID},
+			options.Find().SetProjection(bson.M{"name": 1}),
+		)
+		if err != nil {
+			return conversationNames, personNames, err
+		}
+		if err := cursor.All(ctx, &conversations); err != nil {
+			return conversationNames, personNames, err
+		}
+		for _, conversation := range conversations {
+			conversationNames[conversation.ID] = conversation.Name
+		}
+	}
+
+	if len(personIDs) > 0 {
+		var people []models.Person
+		cursor, err := peopleCollection.Find(ctx, bson.M{"_id": bson.M{"$in": personIDs}, "user_id": userID})
+		if err != nil {
+			return conversationNames, personNames, err
+		}
+		if err := cursor.All(ctx, &people); err != nil {
+			return conversationNames, personNames, err
+		}
+		for _, person := range people {
+			personNames[person.ID] = person.Name
+		}
+	}
+	return conversationNames, personNames, nil
+}
@@ -0,0 +1,69 @@
+package calendar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	icsDate    = "20060102"
+	icsUTCTime = "20060102T150405Z"
+	// icsLineLength is the longest a content line may be, in octets.
+	icsLineLength = 75
+)
+
+// icsWriter writes an iCalendar (RFC 5545) stream, remembering the first
+// write error.
+type icsWriter struct {
+	w   io.Writer
+	err error
+}
+
+// line writes a content line, folding it onto continuation lines that start
+// with a space so that none is longer than icsLineLength octets. Lines are
+// only split between UTF-8 characters.
+func (w *icsWriter) line(name, value string) {
+	if w.err != nil {
+		return
+	}
+	content := name + ":" + value
+	var b strings.Builder
+	length := 0
+	for _, r := range content {
+		size := len(string(r))
+		if length+size > icsLineLength {
+			b.WriteString("\r\n ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += size
+	}
+	b.WriteString("\r\n")
+	_, w.err = io.WriteString(w.w, b.String())
+}
+
+// text writes a property with a TEXT value.
+func (w *icsWriter) text(name, value string) {
+	w.line(name, escapeText(value))
+}
+
+func (w *icsWriter) utc(name string, t time.Time) {
+	w.line(name, t.UTC().Format(icsUTCTime))
+}
+
+func (w *icsWriter) date(name string, t time.Time) {
+	w.line(name+";VALUE=DATE", t.Format(icsDate))
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func escapeText(value string) string {
+	return textEscaper.Replace(value)
+}
+
+// uid is a globally unique identifier for a calendar component.
+func uid(kind, id string) string {
+	return fmt.Sprintf("%s-%s@omi-webapp", kind, id)
+}
@@ -0,0 +1,132 @@
+package calendar
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/dates"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+func EnsureIndexes(ctx context.Context, meetings, feeds *mongo.Collection) error {
+	_, err := meetings.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "start", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "conversation_id", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = feeds.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+var (
+	// meetingCue matches sentences about getting together.
+	meetingCue = regexp.MustCompile(`\b(meet|meeting|call|catch up|catch-up|sync|standup|stand-up|get together|reconvene|regroup|demo|interview|appointment|lunch|coffee|1:1|one-on-one)\b`)
+	// pastTense matches sentences about a meeting that already happened.
+	pastTense = regexp.MustCompile(`\b(was|were|had|went|met|last|yesterday|ago)\b`)
+)
+
+// defaultMeetingLength is how long a meeting with a start time lasts in the
+// feed, since transcripts rarely say.
+const defaultMeetingLength = time.Hour
+
+// Detect finds the meetings arranged in a conversation: transcript sentences
+// that mention getting together on a day ("let's meet Thursday at 3"),
+// resolved against when they were said in the user's time zone loc.
+// Sentences about past meetings are skipped. A meeting without a time of day
+// is all-day, starting at midnight UTC on its date; others start at their
+// time of day in loc. A sentence said more than once only counts the first
+// time.
+func Detect(conversation models.Conversation, loc *time.Location) []models.Meeting {
+	meetings := []models.Meeting{}
+	seen := map[string]bool{}
+	for i, sentence := range conversation.Transcript {
+		lower := strings.ToLower(sentence.Sentence)
+		if !meetingCue.MatchString(lower) || pastTense.MatchString(lower) {
+			continue
+		}
+		key := meetingKey(sentence.Sentence)
+		if seen[key] {
+			continue
+		}
+		said := conversation.CreatedAt.Add(time.Duration(sentence.Start * float64(time.Second))).In(loc)
+		day, ok := dates.FindDay(sentence.Sentence, said)
+		if !ok {
+			continue
+		}
+		seen[key] = true
+		meeting := models.Meeting{
+			UserID:         conversation.UserID,
+			ConversationID: conversation.ID,
+			Key:            key,
+			SentenceIndex:  i,
+			Text:           strings.TrimSpace(sentence.Sentence),
+			Start:          day.Date,
+			AllDay:         true,
+		}
+		if clock, ok := dates.FindTime(sentence.Sentence); ok {
+			meeting.Start = time.Date(day.Date.Year(), day.Date.Month(), day.Date.Day(), clock.Hour, clock.Minute, 0, 0, loc).UTC()
+			meeting.AllDay = false
+		}
+		meetings = append(meetings, meeting)
+	}
+	return meetings
+}
+
+// meetingKey identifies a meeting by the normalised text of its sentence.
+func meetingKey(sentence string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Join(strings.Fields(sentence), " "))))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SyncMeetings brings the meetings stored for a conversation in line with
+// those detected in its current transcript, read in the time zone loc.
+// Meetings are updated in place by key, so calendar clients keep seeing the
+// same event across changes to the conversation, and removed once their
+// sentence is gone.
+func SyncMeetings(ctx context.Context, meetingsCollection *mongo.Collection, conversation models.Conversation, loc *time.Location) error {
+	meetings := Detect(conversation, loc)
+	keys := make([]string, len(meetings))
+	now := time.Now()
+	for i, meeting := range meetings {
+		keys[i] = meeting.Key
+		_, err := meetingsCollection.UpdateOne(ctx,
+			bson.M{"conversation_id": conversation.ID, "key": meeting.Key},
+			bson.M{
+				"$set": bson.M{
+					"user_id":        meeting.UserID,
+					"sentence_index": meeting.SentenceIndex,
+					"text":           meeting.Text,
+					"start":          meeting.Start,
+					"all_day":        meeting.AllDay,
+				},
+				"$setOnInsert": bson.M{"created_at": now},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("error saving meeting: %v", err)
+		}
+	}
+	_, err := meetingsCollection.DeleteMany(ctx, bson.M{"conversation_id": conversation.ID, "key": bson.M{"$nin": keys}})
+	if err != nil {
+		return fmt.Errorf("error deleting meetings: %v", err)
+	}
+	return nil
+}
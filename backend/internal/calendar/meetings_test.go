@@ -0,0 +1,53 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+func TestDetect(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	// Monday 21:00 in New York, already Tuesday in UTC.
+	conversation := models.Conversation{
+		CreatedAt: time.Date(2026, 10, 20, 1, 0, 0, 0, time.UTC),
+		Transcript: []models.TranscriptionSentence{
+			{Sentence: "Let's meet tomorrow at 3", Start: 10},
+			{Sentence: "We met last Friday at 2", Start: 20},
+			{Sentence: "Lunch on Thursday?", Start: 30},
+			{Sentence: "let's  meet tomorrow at 3", Start: 40},
+			{Sentence: "Tomorrow works", Start: 50},
+		},
+	}
+	tests := []struct {
+		loc    *time.Location
+		starts []string
+	}{
+		{time.UTC, []string{"2026-10-21T15:00:00Z", "2026-10-22T00:00:00Z"}},
+		{newYork, []string{"2026-10-20T19:00:00Z", "2026-10-22T00:00:00Z"}},
+	}
+	for _, test := range tests {
+		meetings := Detect(conversation, test.loc)
+		var starts []string
+		for _, meeting := range meetings {
+			starts = append(starts, meeting.Start.Format(time.RFC3339))
+		}
+		if len(starts) != len(test.starts) {
+			t.Errorf("Detect in %s = %v, want %v", test.loc, starts, test.starts)
+			continue
+		}
+		for i := range starts {
+			if starts[i] != test.starts[i] {
+				t.Errorf("Detect in %s = %v, want %v", test.loc, starts, test.starts)
+				break
+			}
+		}
+		if len(meetings) == 2 && (meetings[0].AllDay || !meetings[1].AllDay) {
+			t.Errorf("Detect in %s: all-day = %v, %v, want false, true", test.loc, meetings[0].AllDay, meetings[1].AllDay)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// UserLocation returns the time zone the user's conversations are read in,
+// UTC unless they have set one.
+func UserLocation(ctx context.Context, usersCollection *mongo.Collection, userID primitive.ObjectID) (*time.Location, error) {
+	var user models.User
+	err := usersCollection.FindOne(ctx,
+		bson.M{"_id": userID},
+		options.FindOne().SetProjection(bson.M{"time_zone": 1}),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return time.UTC, nil
+	}
+	if err != nil {
+		return time.UTC, err
+	}
+	if user.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(user.TimeZone)
+	if err != nil {
+		return time.UTC, err
+	}
+	return loc, nil
+}
+
+// SetTimeZone sets the IANA time zone ("Europe/Berlin") that days and times
+// said in the user's conversations are read in. Meetings are detected again
+// in the new zone; action items keep the due dates they were given.
+func SetTimeZone(usersCollection, conversationsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			TimeZone string `json:"time_zone"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		request.TimeZone = strings.TrimSpace(request.TimeZone)
+		// LoadLocation reads "" and "Local" as UTC and the server's zone.
+		if request.TimeZone == "" || request.TimeZone == "Local" {
+			http.Error(w, "Invalid time zone", http.StatusBadRequest)
+			return
+		}
+		if _, err := time.LoadLocation(request.TimeZone); err != nil {
+			http.Error(w, "Invalid time zone", http.StatusBadRequest)
+			return
+		}
+
+		result, err := usersCollection.UpdateOne(context.TODO(),
+			bson.M{"_id": userID},
+			bson.M{"$set": bson.M{"time_zone": request.TimeZone}},
+		)
+		if err != nil {
+			http.Error(w, "Error saving time zone", http.StatusInternalServerError)
+			return
+		}
+		if result.MatchedCount == 0 {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		_, err = conversationsCollection.UpdateMany(context.TODO(),
+			bson.M{"user_id": userID, "deleted_at": nil},
+			bson.M{"$set": bson.M{"needs_action_sync": true}},
+		)
+		if err != nil {
+			http.Error(w, "Error updating meetings", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"time_zone": request.TimeZone})
+	}
+}
@@ -0,0 +1,385 @@
+package conversations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/embeddings"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/export"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/llm"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/people"
+)
+
+const (
+	defaultAskSources = 8
+	maxAskSources     = 20
+	// speakerBoost ranks passages in which a person named in the question
+	// speaks above otherwise similar ones.
+	speakerBoost = 0.2
+	// textSearchConversations is how many keyword search hits are used to
+	// fill up the sources when there are too few embedded passages.
+	textSearchConversations = 5
+)
+
+const askPrompt = `You answer questions about the user's recorded conversations.
+Today is %s. Use only the numbered transcript excerpts below; if they do not contain the answer, say so.
+Cite the excerpts you use by their number in square brackets, e.g. [2].`
+
+var citationPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// AskCitation is a transcript passage an answer is based on. Start is where
+// the passage begins in the recording, in seconds.
+type AskCitation struct {
+	Index            int                `json:"index"`
+	ConversationID   primitive.ObjectID `json:"conversation_id"`
+	ConversationName string             `json:"conversation_name"`
+	CreatedAt        time.Time          `json:"created_at"`
+	SentenceIndex    int                `json:"sentence_index"`
+	Start            float64            `json:"start"`
+	End              float64            `json:"end"`
+	Text             string             `json:"text"`
+}
+
+// askSource is a candidate passage for an answer: a range of sentences of
+// one conversation.
+type askSource struct {
+	conversationID primitive.ObjectID
+	first, last    int
+	score          float64
+}
+
+// Ask answers a question from passages across all of the user's
+// conversations. Passages are found by embedding search, topped up with
+// keyword search, and passed to the user's LLM provider with an instruction
+// to cite them. The response lists the passages the answer cites, or all
+// of them if it cites none.
+//
+// The body is {"question": ..., "from": ..., "to": ..., "limit": ...}, where
+// from and to limit the conversations by date as in GetConversations and
+// limit is the number of passages (default 8, up to 20).
+func Ask(collection, peopleCollection, chunksCollection, gcpCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Question string `json:"question"`
+			From     string `json:"from"`
+			To       string `json:"to"`
+			Limit    int    `json:"limit"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		question := strings.TrimSpace(request.Question)
+		if question == "" {
+			http.Error(w, "Question is required", http.StatusBadRequest)
+			return
+		}
+		if len(question) > maxQueryLength {
+			http.Error(w, "Question is too long", http.StatusBadRequest)
+			return
+		}
+		limit := request.Limit
+		if limit == 0 {
+			limit = defaultAskSources
+		}
+		if limit < 1 || limit > maxAskSources {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		filter := bson.M{}
+		createdAt := bson.M{}
+		for param, value := range map[string]string{"from": request.From, "to": request.To} {
+			if value == "" {
+				continue
+			}
+			t, err := parseDate(value, param == "to")
+			if err != nil {
+				http.Error(w, "Invalid "+param, http.StatusBadRequest)
+				return
+			}
+			if param == "from" {
+				createdAt["$gte"] = t
+			} else {
+				createdAt["$lte"] = t
+			}
+		}
+		if len(createdAt) > 0 {
+			filter["created_at"] = createdAt
+		}
+
+		sources, conversations, err := findSources(context.TODO(), collection, peopleCollection, chunksCollection, gcpCollection, userID, question, limit, filter)
+		if errors.Is(err, embeddings.ErrUnauthorized) {
+			http.Error(w, "Embedding provider rejected the API key", http.StatusBadGateway)
+			return
+		}
+		if err != nil {
+			log.Printf("Error finding passages: %v", err)
+			http.Error(w, "Error searching conversations", http.StatusInternalServerError)
+			return
+		}
+
+		citations := make([]AskCitation, len(sources))
+		for i, source := range sources {
+			conversation := conversations[source.conversationID]
+			citations[i] = AskCitation{
+				Index:            i + 1,
+				ConversationID:   conversation.ID,
+				ConversationName: conversation.Name,
+				CreatedAt:        conversation.CreatedAt,
+				SentenceIndex:    source.first,
+				Start:            conversation.Transcript[source.first].Start,
+				End:              conversation.Transcript[source.last].End,
+				Text:             passageText(conversation, source),
+			}
+		}
+		if len(citations) == 0 {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"answer":    "I couldn't find anything about that in your conversations.",
+				"citations": citations,
+			})
+			return
+		}
+
+		var prompt strings.Builder
+		fmt.Fprintf(&prompt, askPrompt, time.Now().Format("Monday, 2 January 2006"))
+		prompt.WriteString("\n\n")
+		for _, citation := range citations {
+			fmt.Fprintf(&prompt, "[%d] %q, recorded %s, from %s: %s\n",
+				citation.Index, citation.ConversationName, citation.CreatedAt.Format("Mon 2 Jan 2006 15:04"), export.Clock(citation.Start), citation.Text)
+		}
+
+		provider, err := llm.UserProvider(context.TODO(), gcpCollection, userID)
+		if err != nil {
+			log.Printf("Error loading LLM provider: %v", err)
+			http.Error(w, "Error loading assistant", http.StatusInternalServerError)
+			return
+		}
+		answer, err := provider.Complete(context.TODO(), []llm.Message{
+			{Role: llm.RoleSystem, Content: prompt.String()},
+			{Role: llm.RoleUser, Content: question},
+		})
+		if err != nil {
+			log.Printf("Error answering question: %v", err)
+			http.Error(w, "The assistant could not answer", http.StatusBadGateway)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"answer":    answer,
+			"citations": cited(answer, citations),
+		})
+	}
+}
+
+// findSources picks up to limit passages for the question, best first, and
+// returns them with their conversations, speaker names resolved.
+func findSources(ctx context.Context, collection, peopleCollection, chunksCollection, gcpCollection *mongo.Collection, userID primitive.ObjectID, question string, limit int, filter bson.M) ([]askSource, map[primitive.ObjectID]models.Conversation, error) {
+	provider, err := embeddings.UserProvider(ctx, gcpCollection, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	passages, err := embeddings.Search(ctx, chunksCollection, collection, provider, userID, question, limit*3, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sources []askSource
+	for _, passage := range passages {
+		sources = append(sources, askSource{passage.ConversationID, passage.FirstSentence, passage.LastSentence, passage.Score})
+	}
+
+	// Top up with keyword matches, for conversations not embedded yet.
+	if len(sources) < limit {
+		textFilter := bson.M{"user_id": userID, "deleted_at": nil, "$text": bson.M{"$search": question}}
+		for key, value := range filter {
+			textFilter[key] = value
+		}
+		score := bson.M{"$meta": "textScore"}
+		cursor, err := collection.Find(ctx, textFilter,
+			options.Find().
+				SetProjection(bson.M{"score": score, "transcript": 1}).
+				SetSort(bson.D{{Key: "score", Value: score}}).
+				SetLimit(textSearchConversations),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		var matches []models.Conversation
+		if err := cursor.All(ctx, &matches); err != nil {
+			return nil, nil, err
+		}
+		matcher := newSearchMatcher(question)
+		for _, conversation := range matches {
+			for i, sentence := range conversation.Transcript {
+				if !matcher.matches(sentence.Sentence) {
+					continue
+				}
+				first, last := i, i
+				if first > 0 {
+					first--
+				}
+				if last < len(conversation.Transcript)-1 {
+					last++
+				}
+				sources = append(sources, askSource{conversation.ID, first, last, 0})
+			}
+		}
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, source := range sources {
+		ids = append(ids, source.conversationID)
+	}
+	conversations := map[primitive.ObjectID]models.Conversation{}
+	if len(ids) == 0 {
+		return nil, conversations, nil
+	}
+	cursor, err := collection.Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "user_id": userID},
+		options.Find().SetProjection(bson.M{"user_id": 1, "name": 1, "created_at": 1, "transcript": 1, "speakers": 1}),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var conversation models.Conversation
+		if err := cursor.Decode(&conversation); err != nil {
+			return nil, nil, err
+		}
+		if err := people.Resolve(ctx, peopleCollection, &conversation); err != nil {
+			return nil, nil, err
+		}
+		conversations[conversation.ID] = conversation
+	}
+
+	mentioned := mentionedPeople(ctx, peopleCollection, userID, question)
+	kept := []askSource{}
+	covered := map[primitive.ObjectID][]askSource{}
+	for _, source := range sources {
+		conversation, ok := conversations[source.conversationID]
+		// Passages embedded before a transcript edit may point past its end.
+		if !ok || source.last >= len(conversation.Transcript) || source.first > source.last {
+			continue
+		}
+		if overlaps(covered[source.conversationID], source) {
+			continue
+		}
+		for _, speaker := range conversation.Speakers {
+			if mentioned[speaker.PersonID] && speaksIn(conversation, source, speaker.Label) {
+				source.score += speakerBoost
+				break
+			}
+		}
+		covered[source.conversationID] = append(covered[source.conversationID], source)
+		kept = append(kept, source)
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].score > kept[j].score })
+	if len(kept) > limit {
+		kept = kept[:limit]
+	}
+	return kept, conversations, nil
+}
+
+// mentionedPeople returns the people in the user's directory whose name, or
+// first name, appears in the question.
+func mentionedPeople(ctx context.Context, peopleCollection *mongo.Collection, userID primitive.ObjectID, question string) map[primitive.ObjectID]bool {
+	mentioned := map[primitive.ObjectID]bool{}
+	cursor, err := peopleCollection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error fetching people: %v", err)
+		return mentioned
+	}
+	var directory []models.Person
+	if err := cursor.All(ctx, &directory); err != nil {
+		log.Printf("Error fetching people: %v", err)
+		return mentioned
+	}
+
+	asked := " " + strings.Join(words(question), " ") + " "
+	for _, person := range directory {
+		name := strings.Join(words(person.Name), " ")
+		if name == "" {
+			continue
+		}
+		firstName := strings.Fields(name)[0]
+		if strings.Contains(asked, " "+name+" ") || strings.Contains(asked, " "+firstName+" ") {
+			mentioned[person.ID] = true
+		}
+	}
+	return mentioned
+}
+
+func speaksIn(conversation models.Conversation, source askSource, label string) bool {
+	for _, sentence := range conversation.Transcript[source.first : source.last+1] {
+		if sentence.Speaker == label {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(sources []askSource, source askSource) bool {
+	for _, other := range sources {
+		if source.first <= other.last && other.first <= source.last {
+			return true
+		}
+	}
+	return false
+}
+
+// passageText renders the source's sentences on one line, with speakers.
+func passageText(conversation models.Conversation, source askSource) string {
+	var parts []string
+	speaker := ""
+	for _, sentence := range conversation.Transcript[source.first : source.last+1] {
+		text := strings.TrimSpace(sentence.Sentence)
+		if name := export.SpeakerName(sentence); name != speaker {
+			speaker = name
+			text = name + ": " + text
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, " ")
+}
+
+// cited returns the citations referred to in the answer as [n], in order of
+// first reference, or all of them if there are no references.
+func cited(answer string, citations []AskCitation) []AskCitation {
+	result := []AskCitation{}
+	seen := map[int]bool{}
+	for _, match := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		n, _ := strconv.Atoi(match[1])
+		if n >= 1 && n <= len(citations) && !seen[n] {
+			seen[n] = true
+			result = append(result, citations[n-1])
+		}
+	}
+	if len(result) == 0 {
+		return citations
+	}
+	return result
+}
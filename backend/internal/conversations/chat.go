@@ -0,0 +1,203 @@
+package conversations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/assistant"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/jobs"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/llm"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/people"
+)
+
+// chatTurn is a user message that has been saved and awaits the assistant's
+// reply. Conversation is as it was before the message.
+type chatTurn struct {
+	conversation models.Conversation
+	message      models.ChatMessage
+	provider     llm.Provider
+}
+
+// startChat saves the user's chat message from the request and loads the
+// assistant. It writes an error response and returns nil on failure. The
+// first message about a conversation that has audio but was never
+// transcribed also queues its transcription.
+func startChat(w http.ResponseWriter, r *http.Request, collection, peopleCollection, gcpCollection *mongo.Collection, queue *jobs.Queue) *chatTurn {
+	params := mux.Vars(r)
+	conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+	userID, err := auth.GetUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	// The web app sends the text as "message"; "content" matches ChatMessage.
+	var request struct {
+		Content string `json:"content"`
+		Message string `json:"message"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&request)
+	content := strings.TrimSpace(request.Content)
+	if content == "" {
+		content = strings.TrimSpace(request.Message)
+	}
+	if content == "" {
+		http.Error(w, "Message is required", http.StatusBadRequest)
+		return nil
+	}
+
+	var conversation models.Conversation
+	err = collection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil}).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
+		return nil
+	}
+	if len(conversation.ChatHistory) == 0 && conversation.AudioFile != nil && conversation.TranscriptionStatus == "" && len(conversation.Transcript) == 0 {
+		if _, err := queue.Enqueue(context.TODO(), userID, conversationID); err != nil {
+			log.Printf("Error queuing transcription: %v", err)
+		}
+	}
+
+	provider, err := llm.UserProvider(context.TODO(), gcpCollection, userID)
+	if err != nil {
+		log.Printf("Error loading LLM provider: %v", err)
+		http.Error(w, "Error loading assistant", http.StatusInternalServerError)
+		return nil
+	}
+
+	message := newChatMessage(userID, models.ChatRoleUser, content)
+	if err := appendMessage(collection, conversation, message); err != nil {
+		http.Error(w, "Error adding message", http.StatusInternalServerError)
+		return nil
+	}
+
+	if err := people.Resolve(context.TODO(), peopleCollection, &conversation); err != nil {
+		log.Printf("Error resolving speaker names: %v", err)
+	}
+	return &chatTurn{conversation: conversation, message: message, provider: provider}
+}
+
+func newChatMessage(userID primitive.ObjectID, role, content string) models.ChatMessage {
+	return models.ChatMessage{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Role:      role,
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+}
+
+func appendMessage(collection *mongo.Collection, conversation models.Conversation, message models.ChatMessage) error {
+	_, err := collection.UpdateOne(context.TODO(),
+		bson.M{"_id": conversation.ID, "user_id": conversation.UserID},
+		bson.M{"$push": bson.M{"chat_history": message}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	return err
+}
+
+// AddMessage saves the user's chat message and the assistant's reply to it,
+// which is grounded in the conversation's transcript, summary and earlier
+// chat.
+func AddMessage(collection, peopleCollection, gcpCollection *mongo.Collection, queue *jobs.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		chat := startChat(w, r, collection, peopleCollection, gcpCollection, queue)
+		if chat == nil {
+			return
+		}
+
+		content, err := assistant.Reply(context.TODO(), chat.provider, chat.conversation, chat.message.Content)
+		if err != nil {
+			log.Printf("Error generating reply for conversation %s: %v", chat.conversation.ID.Hex(), err)
+			http.Error(w, "The assistant could not reply", http.StatusBadGateway)
+			return
+		}
+
+		reply := newChatMessage(chat.message.UserID, models.ChatRoleAssistant, content)
+		if err := appendMessage(collection, chat.conversation, reply); err != nil {
+			http.Error(w, "Error saving reply", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]models.ChatMessage{"message": chat.message, "reply": reply})
+	}
+}
+
+// StreamMessage is AddMessage with the reply streamed as server-sent events:
+//
+//	message  the saved user message
+//	delta    {"content": ...}, each piece of the reply as it is generated
+//	done     the saved assistant message
+//	error    {"error": ...}, if the reply failed
+//
+// The reply is saved only once complete. If the client disconnects first,
+// generation stops and nothing is saved.
+func StreamMessage(collection, peopleCollection, gcpCollection *mongo.Collection, queue *jobs.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		chat := startChat(w, r, collection, peopleCollection, gcpCollection, queue)
+		if chat == nil {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		send := func(event string, data interface{}) error {
+			payload, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+
+		if err := send("message", chat.message); err != nil {
+			return
+		}
+		content, err := assistant.StreamReply(r.Context(), chat.provider, chat.conversation, chat.message.Content, func(delta string) error {
+			return send("delta", map[string]string{"content": delta})
+		})
+		if r.Context().Err() != nil {
+			log.Printf("Reply for conversation %s cancelled by the client", chat.conversation.ID.Hex())
+			return
+		}
+		if err != nil {
+			log.Printf("Error generating reply for conversation %s: %v", chat.conversation.ID.Hex(), err)
+			send("error", map[string]string{"error": "The assistant could not reply"})
+			return
+		}
+
+		reply := newChatMessage(chat.message.UserID, models.ChatRoleAssistant, content)
+		if err := appendMessage(collection, chat.conversation, reply); err != nil {
+			log.Printf("Error saving reply for conversation %s: %v", chat.conversation.ID.Hex(), err)
+			send("error", map[string]string{"error": "Error saving reply"})
+			return
+		}
+		send("done", reply)
+	}
+}
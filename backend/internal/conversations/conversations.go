@@ -3,7 +3,9 @@ package conversations
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -12,36 +14,14 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/jobs"
 	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
-	"github.com/TheLickIn13Keys/omi-webapp/internal/transcription"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/people"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/revisions"
 )
 
-func GetConversations(collection *mongo.Collection) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		userID, err := auth.GetUserIDFromRequest(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		var conversations []models.Conversation
-		cursor, err := collection.Find(context.TODO(), bson.M{"user_id": userID})
-		if err != nil {
-			http.Error(w, "Error fetching conversations", http.StatusInternalServerError)
-			return
-		}
-		defer cursor.Close(context.TODO())
-		for cursor.Next(context.TODO()) {
-			var conversation models.Conversation
-			cursor.Decode(&conversation)
-			conversations = append(conversations, conversation)
-		}
-		json.NewEncoder(w).Encode(conversations)
-	}
-}
-
-func GetConversation(collection *mongo.Collection) http.HandlerFunc {
+// GetConversation returns a conversation with its speakers' names resolved.
+func GetConversation(collection, peopleCollection *mongo.Collection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		params := mux.Vars(r)
@@ -58,6 +38,9 @@ func GetConversation(collection *mongo.Collection) http.HandlerFunc {
 			http.Error(w, "Conversation not found", http.StatusNotFound)
 			return
 		}
+		if err := people.Resolve(context.TODO(), peopleCollection, &conversation); err != nil {
+			log.Printf("Error resolving speaker names: %v", err)
+		}
 		json.NewEncoder(w).Encode(conversation)
 	}
 }
@@ -74,6 +57,7 @@ func CreateConversation(collection *mongo.Collection) http.HandlerFunc {
 		}
 
 		conversation.UserID = userID
+		conversation.NeedsActionSync = true
 		conversation.CreatedAt = time.Now()
 		conversation.UpdatedAt = time.Now()
 
@@ -87,7 +71,9 @@ func CreateConversation(collection *mongo.Collection) http.HandlerFunc {
 	}
 }
 
-func AddMessage(collection *mongo.Collection) http.HandlerFunc {
+// UpdateTranscript replaces the transcript with the user's edited version
+// and records the edit as a transcript revision.
+func UpdateTranscript(collection, revisionsCollection *mongo.Collection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		params := mux.Vars(r)
@@ -98,99 +84,74 @@ func AddMessage(collection *mongo.Collection) http.HandlerFunc {
 			return
 		}
 
-		var message models.ChatMessage
-		_ = json.NewDecoder(r.Body).Decode(&message)
-		message.UserID = userID
-		message.Timestamp = time.Now()
-
-		update := bson.M{
-			"$push": bson.M{"chat_history": message},
-			"$set":  bson.M{"updated_at": time.Now()},
+		var transcriptUpdate struct {
+			Transcript []models.TranscriptionSentence `json:"transcript"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&transcriptUpdate); err != nil || transcriptUpdate.Transcript == nil {
+			http.Error(w, "Invalid transcript", http.StatusBadRequest)
+			return
 		}
 
 		var conversation models.Conversation
-		err = collection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID}).Decode(&conversation)
-		if err == nil && len(conversation.ChatHistory) == 0 && conversation.AudioFile != nil {
-
-			var gcpCreds models.GCPCredentials
-			gcpCollection := collection.Database().Collection("gcp_credentials")
-			err = gcpCollection.FindOne(context.TODO(), bson.M{"user_id": userID}).Decode(&gcpCreds)
-			if err == nil {
-				go func() {
-					transcript, summary, actionItems, err := transcription.TranscribeAudio(conversation.AudioFile.URL, gcpCreds.GladiaKey)
-					if err == nil {
-						_, _ = collection.UpdateOne(
-							context.TODO(),
-							bson.M{"_id": conversationID},
-							bson.M{
-								"$set": bson.M{
-									"transcript":   transcript,
-									"summary":      summary,
-									"action_items": actionItems,
-								},
-							},
-						)
-					}
-				}()
-			}
-		}
-		_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID}, update)
-		if err != nil {
-			http.Error(w, "Error adding message", http.StatusInternalServerError)
+		err = collection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil}).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
 			return
 		}
-
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(message)
-	}
-}
-
-func GlobalSearch(collection *mongo.Collection) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
 			return
 		}
-
-		query := r.URL.Query().Get("q")
-		if query == "" {
-			http.Error(w, "Search query is required", http.StatusBadRequest)
+		if err := revisions.Baseline(context.TODO(), revisionsCollection, conversation); err != nil {
+			http.Error(w, "Error saving current transcript", http.StatusInternalServerError)
 			return
 		}
 
-		filter := bson.M{
-			"user_id": userID,
-			"$or": []bson.M{
-				{"name": bson.M{"$regex": query, "$options": "i"}},
-				{"transcript.sentence": bson.M{"$regex": query, "$options": "i"}},
+		update := bson.M{
+			"$set": bson.M{
+				"transcript":        transcriptUpdate.Transcript,
+				"updated_at":        time.Now(),
+				"needs_action_sync": true,
 			},
 		}
-
-		cursor, err := collection.Find(context.TODO(), filter)
+		// Only write over the transcript the edit was made to.
+		result, err := collection.UpdateOne(context.TODO(),
+			bson.M{"_id": conversationID, "user_id": userID, "updated_at": conversation.UpdatedAt},
+			update,
+		)
 		if err != nil {
-			http.Error(w, "Error performing search", http.StatusInternalServerError)
+			http.Error(w, "Error updating transcript", http.StatusInternalServerError)
+			return
+		}
+		if result.MatchedCount == 0 {
+			http.Error(w, "Conversation was modified, reload and try again", http.StatusConflict)
 			return
 		}
-		defer cursor.Close(context.TODO())
 
-		var results []models.Conversation
-		for cursor.Next(context.TODO()) {
-			var conversation models.Conversation
-			if err := cursor.Decode(&conversation); err != nil {
-				http.Error(w, "Error decoding search results", http.StatusInternalServerError)
-				return
-			}
-			results = append(results, conversation)
+		revision, err := revisions.Record(context.TODO(), revisionsCollection, models.TranscriptRevision{
+			ConversationID: conversationID,
+			UserID:         userID,
+			Source:         models.RevisionEdit,
+			AuthorID:       &userID,
+			Transcript:     transcriptUpdate.Transcript,
+			Summary:        conversation.Summary,
+			ActionItems:    conversation.ActionItems,
+			Metadata:       conversation.Metadata,
+		})
+		if err != nil {
+			// The transcript is saved, so the edit still succeeded.
+			log.Printf("Error recording transcript revision: %v", err)
 		}
 
-		json.NewEncoder(w).Encode(results)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Transcript updated successfully", "revision": revision})
 	}
 }
 
-func UpdateTranscript(collection *mongo.Collection) http.HandlerFunc {
+// Retranscribe queues a new transcription of the conversation's audio with
+// the given provider options. The current transcript stays in place, and is
+// kept as a revision, until the new one is ready.
+func Retranscribe(collection *mongo.Collection, queue *jobs.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		params := mux.Vars(r)
@@ -201,24 +162,75 @@ func UpdateTranscript(collection *mongo.Collection) http.HandlerFunc {
 			return
 		}
 
-		var transcriptUpdate struct {
-			Transcript []string `json:"transcript"`
+		var opts models.TranscriptionOptions
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+				http.Error(w, "Invalid options", http.StatusBadRequest)
+				return
+			}
+		}
+		// Analysis prompts come from the user's saved prompts, not the request.
+		opts.Prompts = nil
+		if msg := validateOptions(&opts); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
 		}
-		_ = json.NewDecoder(r.Body).Decode(&transcriptUpdate)
 
-		update := bson.M{
-			"$set": bson.M{
-				"transcript": transcriptUpdate.Transcript,
-				"updated_at": time.Now(),
-			},
+		var conversation models.Conversation
+		err = collection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil}).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
 		}
-		_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID}, update)
 		if err != nil {
-			http.Error(w, "Error updating transcript", http.StatusInternalServerError)
+			http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
+			return
+		}
+		if conversation.AudioFile == nil {
+			http.Error(w, "Conversation has no audio", http.StatusBadRequest)
+			return
+		}
+		switch conversation.TranscriptionStatus {
+		case models.JobQueued, models.JobRunning, models.JobHeld:
+			http.Error(w, "Transcription already in progress", http.StatusConflict)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Transcript updated successfully"})
+		job, err := queue.EnqueueWithOptions(context.TODO(), userID, conversationID, &opts)
+		if err != nil {
+			log.Printf("Error queuing transcription: %v", err)
+			http.Error(w, "Error queuing transcription", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// validateOptions normalises retranscription options and returns a message
+// describing the first invalid one.
+func validateOptions(opts *models.TranscriptionOptions) string {
+	opts.Language = strings.ToLower(strings.TrimSpace(opts.Language))
+	if opts.Language != "" && (len(opts.Language) < 2 || len(opts.Language) > 3) {
+		return "Language must be an ISO 639-1 code"
+	}
+	if opts.SpeakerCount < 0 || opts.SpeakerCount > 20 {
+		return "Speaker count must be between 1 and 20"
+	}
+	if opts.SpeakerCount > 0 && opts.Diarization != nil && !*opts.Diarization {
+		return "Speaker count requires diarization"
+	}
+
+	vocabulary := []string{}
+	for _, word := range opts.CustomVocabulary {
+		if word = strings.TrimSpace(word); word != "" {
+			vocabulary = append(vocabulary, word)
+		}
+	}
+	if len(vocabulary) > 100 {
+		return "Custom vocabulary is limited to 100 entries"
 	}
+	opts.CustomVocabulary = vocabulary
+	return ""
 }
@@ -0,0 +1,252 @@
+package conversations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/revisions"
+)
+
+// maxTranscriptOperations bounds the size of one PATCH request.
+const maxTranscriptOperations = 500
+
+// Transcript patch operations. Every operation addresses a sentence by its
+// index in the transcript as left by the operations before it.
+const (
+	OpEditText   = "edit_text"   // replace a sentence's text
+	OpEditWord   = "edit_word"   // replace one word's text
+	OpSetSpeaker = "set_speaker" // reassign a sentence to another speaker
+	OpSplit      = "split"       // split a sentence before the word at word_index
+	OpMerge      = "merge"       // merge a sentence with the one after it
+)
+
+type TranscriptOperation struct {
+	Op        string `json:"op"`
+	Index     int    `json:"index"`
+	WordIndex int    `json:"word_index"`
+	Text      string `json:"text"`
+	Speaker   string `json:"speaker"`
+}
+
+// PatchTranscript applies a list of sentence operations to the transcript in
+// one step: either all of them apply or none do. Word timings are carried
+// along, so sentence start and end times stay consistent with their words.
+func PatchTranscript(collection, revisionsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var patch struct {
+			Operations []TranscriptOperation `json:"operations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || len(patch.Operations) == 0 {
+			http.Error(w, "Invalid operations", http.StatusBadRequest)
+			return
+		}
+		if len(patch.Operations) > maxTranscriptOperations {
+			http.Error(w, "Too many operations", http.StatusBadRequest)
+			return
+		}
+
+		var conversation models.Conversation
+		err = collection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil}).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
+			return
+		}
+
+		transcript, err := applyOperations(conversation.Transcript, patch.Operations)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := revisions.Baseline(context.TODO(), revisionsCollection, conversation); err != nil {
+			http.Error(w, "Error saving current transcript", http.StatusInternalServerError)
+			return
+		}
+
+		// Only write over the transcript the operations were applied to.
+		now := time.Now()
+		result, err := collection.UpdateOne(context.TODO(),
+			bson.M{"_id": conversationID, "user_id": userID, "updated_at": conversation.UpdatedAt},
+			bson.M{"$set": bson.M{"transcript": transcript, "updated_at": now, "needs_action_sync": true}},
+		)
+		if err != nil {
+			http.Error(w, "Error updating transcript", http.StatusInternalServerError)
+			return
+		}
+		if result.MatchedCount == 0 {
+			http.Error(w, "Conversation was modified, reload and try again", http.StatusConflict)
+			return
+		}
+
+		_, err = revisions.Record(context.TODO(), revisionsCollection, models.TranscriptRevision{
+			ConversationID: conversationID,
+			UserID:         userID,
+			Source:         models.RevisionEdit,
+			AuthorID:       &userID,
+			Transcript:     transcript,
+			Summary:        conversation.Summary,
+			ActionItems:    conversation.ActionItems,
+			Metadata:       conversation.Metadata,
+		})
+		if err != nil {
+			// The transcript is saved; reporting a failure would have the
+			// client apply the operations a second time.
+			log.Printf("Error recording transcript revision: %v", err)
+		}
+
+		conversation.Transcript = transcript
+		conversation.UpdatedAt = now
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+// applyOperations applies operations to a copy of transcript.
+func applyOperations(transcript []models.TranscriptionSentence, operations []TranscriptOperation) ([]models.TranscriptionSentence, error) {
+	sentences := make([]models.TranscriptionSentence, len(transcript))
+	for i, sentence := range transcript {
+		sentences[i] = sentence
+		sentences[i].Words = append([]models.TranscriptionWord(nil), sentence.Words...)
+	}
+
+	for n, op := range operations {
+		if op.Index < 0 || op.Index >= len(sentences) {
+			return nil, fmt.Errorf("operation %d: sentence index %d out of range", n, op.Index)
+		}
+		sentence := &sentences[op.Index]
+
+		switch op.Op {
+		case OpEditText:
+			text := strings.TrimSpace(op.Text)
+			if text == "" {
+				return nil, fmt.Errorf("operation %d: text is required", n)
+			}
+			sentence.Sentence = text
+			sentence.Words = retime(sentence.Words, strings.Fields(text), sentence.Start, sentence.End)
+
+		case OpEditWord:
+			word := strings.TrimSpace(op.Text)
+			if op.WordIndex < 0 || op.WordIndex >= len(sentence.Words) {
+				return nil, fmt.Errorf("operation %d: word index %d out of range", n, op.WordIndex)
+			}
+			if word == "" || strings.ContainsAny(word, " \t\n") {
+				return nil, fmt.Errorf("operation %d: text must be a single word", n)
+			}
+			sentence.Words[op.WordIndex].Word = word
+			sentence.Sentence = joinWords(sentence.Words)
+
+		case OpSetSpeaker:
+			speaker := strings.TrimSpace(op.Speaker)
+			if speaker == "" {
+				return nil, fmt.Errorf("operation %d: speaker is required", n)
+			}
+			sentence.Speaker = speaker
+
+		case OpSplit:
+			if op.WordIndex <= 0 || op.WordIndex >= len(sentence.Words) {
+				return nil, fmt.Errorf("operation %d: sentences can only be split between two of their words", n)
+			}
+			first, second := *sentence, *sentence
+			first.Words = append([]models.TranscriptionWord(nil), sentence.Words[:op.WordIndex]...)
+			second.Words = append([]models.TranscriptionWord(nil), sentence.Words[op.WordIndex:]...)
+			settle(&first)
+			settle(&second)
+			sentences = append(sentences[:op.Index], append([]models.TranscriptionSentence{first, second}, sentences[op.Index+1:]...)...)
+
+		case OpMerge:
+			if op.Index+1 >= len(sentences) {
+				return nil, fmt.Errorf("operation %d: the last sentence has nothing to merge with", n)
+			}
+			next := sentences[op.Index+1]
+			merged := *sentence
+			merged.Words = append(append([]models.TranscriptionWord(nil), sentence.Words...), next.Words...)
+			if len(sentence.Words) > 0 && len(next.Words) > 0 {
+				settle(&merged)
+			} else {
+				merged.Sentence = strings.TrimSpace(sentence.Sentence + " " + next.Sentence)
+				merged.End = next.End
+				merged.Confidence = (sentence.Confidence + next.Confidence) / 2
+			}
+			sentences = append(sentences[:op.Index], append([]models.TranscriptionSentence{merged}, sentences[op.Index+2:]...)...)
+
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", n, op.Op)
+		}
+	}
+	return sentences, nil
+}
+
+// retime gives a sentence's edited text word timings. When the word count is
+// unchanged each word keeps its timing; otherwise the new words are spread
+// evenly over the sentence.
+func retime(words []models.TranscriptionWord, texts []string, start, end float64) []models.TranscriptionWord {
+	if len(words) == 0 {
+		return words
+	}
+	if len(words) == len(texts) {
+		for i := range words {
+			if words[i].Word != texts[i] {
+				words[i].Word = texts[i]
+				words[i].Confidence = 1
+			}
+		}
+		return words
+	}
+
+	retimed := make([]models.TranscriptionWord, len(texts))
+	step := (end - start) / float64(len(texts))
+	for i, text := range texts {
+		retimed[i] = models.TranscriptionWord{
+			Word:       text,
+			Start:      start + step*float64(i),
+			End:        start + step*float64(i+1),
+			Confidence: 1,
+		}
+	}
+	return retimed
+}
+
+// settle recomputes a sentence's text, timing and confidence from its words.
+func settle(sentence *models.TranscriptionSentence) {
+	words := sentence.Words
+	sentence.Sentence = joinWords(words)
+	sentence.Start = words[0].Start
+	sentence.End = words[len(words)-1].End
+	total := 0.0
+	for _, word := range words {
+		total += word.Confidence
+	}
+	sentence.Confidence = total / float64(len(words))
+}
+
+func joinWords(words []models.TranscriptionWord) string {
+	texts := make([]string, len(words))
+	for i, word := range words {
+		texts[i] = strings.TrimSpace(word.Word)
+	}
+	return strings.Join(texts, " ")
+}
@@ -0,0 +1,145 @@
+package conversations
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+func timedWords(start float64, confidence float64, texts ...string) []models.TranscriptionWord {
+	result := make([]models.TranscriptionWord, len(texts))
+	for i, text := range texts {
+		result[i] = models.TranscriptionWord{Word: text, Start: start + float64(i), End: start + float64(i+1), Confidence: confidence}
+	}
+	return result
+}
+
+// transcript has two sentences with word timings and a last one without.
+func transcript() []models.TranscriptionSentence {
+	return []models.TranscriptionSentence{
+		{Sentence: "hello there friend", Start: 0, End: 3, Speaker: "A", Confidence: 0.9, Words: timedWords(0, 0.9, "hello", "there", "friend")},
+		{Sentence: "how are you", Start: 3, End: 6, Speaker: "B", Confidence: 0.6, Words: timedWords(3, 0.6, "how", "are", "you")},
+		{Sentence: "fine", Start: 6, End: 7, Speaker: "A", Confidence: 0.8},
+	}
+}
+
+// describe renders sentences as "speaker:text[start-end]".
+func describe(sentences []models.TranscriptionSentence) string {
+	parts := make([]string, len(sentences))
+	for i, s := range sentences {
+		parts[i] = fmt.Sprintf("%s:%s[%g-%g]", s.Speaker, s.Sentence, s.Start, s.End)
+	}
+	return strings.Join(parts, " | ")
+}
+
+func TestApplyOperations(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []TranscriptOperation
+		want string
+	}{
+		{"split", []TranscriptOperation{{Op: OpSplit, Index: 0, WordIndex: 1}},
+			"A:hello[0-1] | A:there friend[1-3] | B:how are you[3-6] | A:fine[6-7]"},
+		{"split then merge back", []TranscriptOperation{{Op: OpSplit, Index: 0, WordIndex: 1}, {Op: OpMerge, Index: 0}},
+			"A:hello there friend[0-3] | B:how are you[3-6] | A:fine[6-7]"},
+		{"split then edit the second half", []TranscriptOperation{{Op: OpSplit, Index: 0, WordIndex: 2}, {Op: OpEditText, Index: 1, Text: "pal"}},
+			"A:hello there[0-2] | A:pal[2-3] | B:how are you[3-6] | A:fine[6-7]"},
+		{"merge", []TranscriptOperation{{Op: OpMerge, Index: 0}},
+			"A:hello there friend how are you[0-6] | A:fine[6-7]"},
+		{"merge with a sentence without words", []TranscriptOperation{{Op: OpMerge, Index: 1}},
+			"A:hello there friend[0-3] | B:how are you fine[3-7]"},
+		{"edit word", []TranscriptOperation{{Op: OpEditWord, Index: 1, WordIndex: 2, Text: "y'all"}},
+			"A:hello there friend[0-3] | B:how are y'all[3-6] | A:fine[6-7]"},
+		{"edit text", []TranscriptOperation{{Op: OpEditText, Index: 2, Text: "  fine thanks "}},
+			"A:hello there friend[0-3] | B:how are you[3-6] | A:fine thanks[6-7]"},
+		{"set speaker", []TranscriptOperation{{Op: OpSetSpeaker, Index: 2, Speaker: "C"}},
+			"A:hello there friend[0-3] | B:how are you[3-6] | C:fine[6-7]"},
+		{"merge after split", []TranscriptOperation{{Op: OpSplit, Index: 1, WordIndex: 1}, {Op: OpMerge, Index: 2}},
+			"A:hello there friend[0-3] | B:how[3-4] | B:are you fine[4-7]"},
+	}
+	for _, test := range tests {
+		original := transcript()
+		got, err := applyOperations(original, test.ops)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if describe(got) != test.want {
+			t.Errorf("%s:\n got %s\nwant %s", test.name, describe(got), test.want)
+		}
+		if describe(original) != describe(transcript()) || original[1].Words[2].Word != "you" {
+			t.Errorf("%s: the original transcript was changed", test.name)
+		}
+	}
+}
+
+func TestApplyOperationsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []TranscriptOperation
+	}{
+		{"index out of range", []TranscriptOperation{{Op: OpSetSpeaker, Index: 3, Speaker: "C"}}},
+		{"negative index", []TranscriptOperation{{Op: OpSetSpeaker, Index: -1, Speaker: "C"}}},
+		{"split before the first word", []TranscriptOperation{{Op: OpSplit, Index: 0, WordIndex: 0}}},
+		{"split after the last word", []TranscriptOperation{{Op: OpSplit, Index: 0, WordIndex: 3}}},
+		{"split a sentence without words", []TranscriptOperation{{Op: OpSplit, Index: 2, WordIndex: 1}}},
+		{"merge the last sentence", []TranscriptOperation{{Op: OpMerge, Index: 2}}},
+		{"edit word with several words", []TranscriptOperation{{Op: OpEditWord, Index: 0, WordIndex: 0, Text: "hi you"}}},
+		{"edit word out of range", []TranscriptOperation{{Op: OpEditWord, Index: 0, WordIndex: 3, Text: "hi"}}},
+		{"empty text", []TranscriptOperation{{Op: OpEditText, Index: 0, Text: " "}}},
+		{"empty speaker", []TranscriptOperation{{Op: OpSetSpeaker, Index: 0}}},
+		{"unknown op", []TranscriptOperation{{Op: "delete", Index: 0}}},
+		{"index past a merge", []TranscriptOperation{{Op: OpMerge, Index: 0}, {Op: OpSetSpeaker, Index: 2, Speaker: "C"}}},
+	}
+	for _, test := range tests {
+		original := transcript()
+		if got, err := applyOperations(original, test.ops); err == nil {
+			t.Errorf("%s: got %s, want an error", test.name, describe(got))
+		}
+		if describe(original) != describe(transcript()) {
+			t.Errorf("%s: the original transcript was changed", test.name)
+		}
+	}
+}
+
+func TestRetime(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts []string
+		want  string // word[start-end]@confidence
+	}{
+		{"same word count keeps timings", []string{"how", "were", "you"},
+			"how[3-4]@0.6 were[4-5]@1 you[5-6]@0.6"},
+		{"more words are spread evenly", []string{"how", "are", "you", "doing"},
+			"how[3-3.75]@1 are[3.75-4.5]@1 you[4.5-5.25]@1 doing[5.25-6]@1"},
+		{"fewer words are spread evenly", []string{"hi"},
+			"hi[3-6]@1"},
+	}
+	for _, test := range tests {
+		retimed := retime(timedWords(3, 0.6, "how", "are", "you"), test.texts, 3, 6)
+		parts := make([]string, len(retimed))
+		for i, w := range retimed {
+			parts[i] = fmt.Sprintf("%s[%g-%g]@%g", w.Word, w.Start, w.End, w.Confidence)
+		}
+		if got := strings.Join(parts, " "); got != test.want {
+			t.Errorf("%s:\n got %s\nwant %s", test.name, got, test.want)
+		}
+	}
+
+	if got := retime(nil, []string{"hi"}, 0, 1); len(got) != 0 {
+		t.Errorf("retime without words = %v, want none", got)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	sentence := models.TranscriptionSentence{Sentence: "stale", Start: 9, End: 9, Words: []models.TranscriptionWord{
+		{Word: " how ", Start: 3, End: 4, Confidence: 0.5},
+		{Word: "are", Start: 4, End: 5, Confidence: 1},
+	}}
+	settle(&sentence)
+	if sentence.Sentence != "how are" || sentence.Start != 3 || sentence.End != 5 || sentence.Confidence != 0.75 {
+		t.Errorf("settle = %q [%g-%g] @%g, want \"how are\" [3-5] @0.75", sentence.Sentence, sentence.Start, sentence.End, sentence.Confidence)
+	}
+}
@@ -0,0 +1,344 @@
+package conversations
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// sortFields maps the ?sort= values to conversation fields.
+var sortFields = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"duration":   "metadata.audio_duration",
+	"name":       "name",
+}
+
+// ConversationListItem is the list projection of a conversation: everything
+// needed to show it in a list, without its transcript or chat history.
+type ConversationListItem struct {
+	ID                  primitive.ObjectID         `json:"id" bson:"_id"`
+	Name                string                     `json:"name" bson:"name"`
+	AudioFile           *models.AudioFile          `json:"audio_file" bson:"audio_file"`
+	Summary             string                     `json:"summary" bson:"summary"`
+	ActionItems         []string                   `json:"action_items" bson:"action_items"`
+	Analysis            map[string]string          `json:"analysis,omitempty" bson:"analysis,omitempty"`
+	TranscriptionStatus string                     `json:"transcription_status,omitempty" bson:"transcription_status,omitempty"`
+	Duration            float64                    `json:"duration" bson:"-"`
+	Languages           []string                   `json:"languages,omitempty" bson:"-"`
+	Speakers            []models.SpeakerAssignment `json:"speakers,omitempty" bson:"speakers,omitempty"`
+	Tags                []string                   `json:"tags,omitempty" bson:"tags,omitempty"`
+	CreatedAt           time.Time                  `json:"created_at" bson:"created_at"`
+	UpdatedAt           time.Time                  `json:"updated_at" bson:"updated_at"`
+	DeletedAt           *time.Time                 `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+
+	Metadata *models.TranscriptionMetadata `json:"-" bson:"metadata,omitempty"`
+}
+
+// pageCursor is the position after the last conversation of a page: its
+// value of the sort field and its ID as a tie-breaker.
+type pageCursor struct {
+	Value interface{}        `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+func encodeCursor(value interface{}, id primitive.ObjectID) string {
+	data, _ := bson.Marshal(pageCursor{Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		Value bson.RawValue      `bson:"v"`
+		ID    primitive.ObjectID `bson:"id"`
+	}
+	if err := bson.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	cursor := &pageCursor{ID: raw.ID}
+	switch raw.Value.Type {
+	case bson.TypeDateTime:
+		cursor.Value = raw.Value.Time()
+	case bson.TypeDouble:
+		cursor.Value = raw.Value.Double()
+	case bson.TypeString:
+		cursor.Value = raw.Value.StringValue()
+	}
+	return cursor, nil
+}
+
+// afterCursor matches the conversations that come after cursor in the given
+// order. Conversations without the sort field (e.g. no duration yet) sort
+// before all others, as in Mongo.
+func afterCursor(field string, ascending bool, cursor *pageCursor) bson.M {
+	op := "$lt"
+	if ascending {
+		op = "$gt"
+	}
+	if cursor.Value == nil {
+		tie := bson.M{field: nil, "_id": bson.M{op: cursor.ID}}
+		if ascending {
+			return bson.M{"$or": []bson.M{tie, {field: bson.M{"$ne": nil}}}}
+		}
+		return tie
+	}
+	after := []bson.M{
+		{field: bson.M{op: cursor.Value}},
+		{field: cursor.Value, "_id": bson.M{op: cursor.ID}},
+	}
+	if !ascending {
+		after = append(after, bson.M{field: nil})
+	}
+	return bson.M{"$or": after}
+}
+
+// GetConversations lists the user's conversations, a page at a time, in the
+// list projection. Query parameters:
+//
+//	sort      created_at (default), updated_at, duration or name
+//	order     asc or desc (default desc, or asc for name)
+//	limit     page size, up to 200 (default 50 once paging)
+//	cursor    the X-Next-Cursor header of the previous page
+//	from, to  created_at range, as RFC 3339 times or YYYY-MM-DD dates
+//	tag       conversations with this tag
+//	speaker   conversations a person speaks in, by person ID or name
+//	language  conversations transcribed in this language
+//	status    comma-separated transcription statuses; "none" for never queued
+//	trash     true to list the conversations in the trash instead
+//
+// The response body is a JSON array. Without limit or cursor, all matching
+// conversations are returned in one response, as clients written before
+// paging expect. Otherwise, when there are more conversations, the
+// X-Next-Cursor header holds the cursor for the next page.
+func GetConversations(collection, peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query()
+
+		sortName := query.Get("sort")
+		if sortName == "" {
+			sortName = "created_at"
+		}
+		field, ok := sortFields[sortName]
+		if !ok {
+			http.Error(w, "Invalid sort", http.StatusBadRequest)
+			return
+		}
+		ascending := sortName == "name"
+		switch query.Get("order") {
+		case "":
+		case "asc":
+			ascending = true
+		case "desc":
+			ascending = false
+		default:
+			http.Error(w, "Invalid order", http.StatusBadRequest)
+			return
+		}
+
+		paged := query.Get("limit") != "" || query.Get("cursor") != ""
+		limit := defaultPageSize
+		if value := query.Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxPageSize {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		filters := []bson.M{{"user_id": userID, "deleted_at": nil}}
+		if query.Get("trash") == "true" {
+			filters[0]["deleted_at"] = bson.M{"$ne": nil}
+		}
+		if value := query.Get("cursor"); value != "" {
+			cursor, err := decodeCursor(value)
+			if err != nil {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			filters = append(filters, afterCursor(field, ascending, cursor))
+		}
+
+		createdAt := bson.M{}
+		for param, op := range map[string]string{"from": "$gte", "to": "$lte"} {
+			value := query.Get(param)
+			if value == "" {
+				continue
+			}
+			t, err := parseDate(value, param == "to")
+			if err != nil {
+				http.Error(w, "Invalid "+param, http.StatusBadRequest)
+				return
+			}
+			createdAt[op] = t
+		}
+		if len(createdAt) > 0 {
+			filters = append(filters, bson.M{"created_at": createdAt})
+		}
+		if tag := query.Get("tag"); tag != "" {
+			filters = append(filters, bson.M{"tags": tag})
+		}
+		if language := query.Get("language"); language != "" {
+			filters = append(filters, bson.M{"metadata.languages": strings.ToLower(language)})
+		}
+		if speaker := query.Get("speaker"); speaker != "" {
+			personID, err := findPerson(peopleCollection, userID, speaker)
+			if err == mongo.ErrNoDocuments {
+				json.NewEncoder(w).Encode([]ConversationListItem{})
+				return
+			}
+			if err != nil {
+				http.Error(w, "Error fetching person", http.StatusInternalServerError)
+				return
+			}
+			filters = append(filters, bson.M{"speakers.person_id": personID})
+		}
+		if status := query.Get("status"); status != "" {
+			var statuses []interface{}
+			for _, s := range strings.Split(status, ",") {
+				if s = strings.TrimSpace(s); s == "none" {
+					statuses = append(statuses, nil, "")
+				} else if s != "" {
+					statuses = append(statuses, s)
+				}
+			}
+			filters = append(filters, bson.M{"transcription_status": bson.M{"$in": statuses}})
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: field, Value: direction(ascending)}, {Key: "_id", Value: direction(ascending)}}).
+			SetProjection(bson.M{"transcript": 0, "chat_history": 0})
+		if paged {
+			opts.SetLimit(int64(limit + 1))
+		}
+		if sortName == "name" {
+			opts.SetCollation(&options.Collation{Locale: "en", Strength: 2})
+		}
+
+		cursor, err := collection.Find(context.TODO(), bson.M{"$and": filters}, opts)
+		if err != nil {
+			http.Error(w, "Error fetching conversations", http.StatusInternalServerError)
+			return
+		}
+		defer cursor.Close(context.TODO())
+
+		items := []ConversationListItem{}
+		if err := cursor.All(context.TODO(), &items); err != nil {
+			http.Error(w, "Error decoding conversations", http.StatusInternalServerError)
+			return
+		}
+		if paged && len(items) > limit {
+			items = items[:limit]
+			last := items[limit-1]
+			w.Header().Set("X-Next-Cursor", encodeCursor(sortValue(last, sortName), last.ID))
+		}
+		for i := range items {
+			if items[i].Metadata != nil {
+				items[i].Duration = items[i].Metadata.AudioDuration
+				items[i].Languages = items[i].Metadata.Languages
+			}
+		}
+		json.NewEncoder(w).Encode(items)
+	}
+}
+
+func direction(ascending bool) int {
+	if ascending {
+		return 1
+	}
+	return -1
+}
+
+func sortValue(item ConversationListItem, sortName string) interface{} {
+	switch sortName {
+	case "updated_at":
+		return item.UpdatedAt
+	case "duration":
+		if item.Metadata == nil {
+			return nil
+		}
+		return item.Metadata.AudioDuration
+	case "name":
+		return item.Name
+	}
+	return item.CreatedAt
+}
+
+// parseDate accepts an RFC 3339 time or a YYYY-MM-DD date, which as an upper
+// bound covers the whole day.
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Millisecond)
+	}
+	return t, nil
+}
+
+// findPerson resolves a speaker filter given as a person ID or name.
+func findPerson(peopleCollection *mongo.Collection, userID primitive.ObjectID, speaker string) (primitive.ObjectID, error) {
+	filter := bson.M{"user_id": userID, "name": speaker}
+	if id, err := primitive.ObjectIDFromHex(speaker); err == nil {
+		filter = bson.M{"user_id": userID, "_id": id}
+	}
+	var person models.Person
+	err := peopleCollection.FindOne(context.TODO(), filter).Decode(&person)
+	return person.ID, err
+}
+
+func EnsureIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "tags", Value: 1}}},
+		{
+			Keys: bson.D{
+				{Key: "user_id", Value: 1},
+				{Key: "name", Value: "text"},
+				{Key: "summary", Value: "text"},
+				{Key: "action_items", Value: "text"},
+				{Key: "transcript.sentence", Value: "text"},
+				{Key: "chat_history.content", Value: "text"},
+			},
+			Options: options.Index().SetName("search").SetWeights(bson.D{
+				{Key: "name", Value: 10},
+				{Key: "summary", Value: 5},
+				{Key: "action_items", Value: 3},
+				{Key: "transcript.sentence", Value: 2},
+				{Key: "chat_history.content", Value: 1},
+			}),
+		},
+	})
+	return err
+}
@@ -0,0 +1,223 @@
+package conversations
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/people"
+)
+
+const (
+	defaultSearchResults = 20
+	maxSearchResults     = 100
+	maxSnippets          = 5
+	maxQueryLength       = 500
+)
+
+// SearchResult is a matching conversation with its relevance score and the
+// places in it that matched.
+type SearchResult struct {
+	models.Conversation `bson:",inline"`
+	Score               float64         `json:"score" bson:"score"`
+	Snippets            []SearchSnippet `json:"snippets" bson:"-"`
+}
+
+// SearchSnippet is one matching piece of a conversation. Field is name,
+// summary, action_items, transcript or chat_history; transcript snippets
+// carry the sentence's position, speaker and timing.
+type SearchSnippet struct {
+	Field         string   `json:"field"`
+	Text          string   `json:"text"`
+	SentenceIndex *int     `json:"sentence_index,omitempty"`
+	Speaker       string   `json:"speaker,omitempty"`
+	SpeakerName   string   `json:"speaker_name,omitempty"`
+	Start         *float64 `json:"start,omitempty"`
+	End           *float64 `json:"end,omitempty"`
+}
+
+// GlobalSearch searches the user's conversations with the conversations text
+// index, most relevant first. The q parameter uses MongoDB text search
+// syntax: words, "quoted phrases" and -excluded words. limit caps the number
+// of conversations (default 20, up to 100).
+func GlobalSearch(collection, peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			http.Error(w, "Search query is required", http.StatusBadRequest)
+			return
+		}
+		if len(query) > maxQueryLength {
+			http.Error(w, "Search query is too long", http.StatusBadRequest)
+			return
+		}
+		limit := defaultSearchResults
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxSearchResults {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		score := bson.M{"$meta": "textScore"}
+		cursor, err := collection.Find(context.TODO(),
+			bson.M{"user_id": userID, "deleted_at": nil, "$text": bson.M{"$search": query}},
+			options.Find().
+				SetProjection(bson.M{"score": score}).
+				SetSort(bson.D{{Key: "score", Value: score}, {Key: "created_at", Value: -1}}).
+				SetLimit(int64(limit)),
+		)
+		if err != nil {
+			http.Error(w, "Error performing search", http.StatusInternalServerError)
+			return
+		}
+		defer cursor.Close(context.TODO())
+
+		matcher := newSearchMatcher(query)
+		results := []SearchResult{}
+		for cursor.Next(context.TODO()) {
+			var result SearchResult
+			if err := cursor.Decode(&result); err != nil {
+				http.Error(w, "Error decoding search results", http.StatusInternalServerError)
+				return
+			}
+			if err := people.Resolve(context.TODO(), peopleCollection, &result.Conversation); err != nil {
+				http.Error(w, "Error resolving speaker names", http.StatusInternalServerError)
+				return
+			}
+			result.Snippets = matcher.snippets(result.Conversation)
+			results = append(results, result)
+		}
+
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// searchMatcher finds the text that a text search matched. Mongo only
+// reports which documents matched, so the query is applied again here to
+// each field. Words are compared by a rough stem so that the plural and
+// -ing/-ed forms the text index treats as equal also match here.
+type searchMatcher struct {
+	terms   map[string]bool
+	phrases []string
+}
+
+func newSearchMatcher(query string) *searchMatcher {
+	m := &searchMatcher{terms: map[string]bool{}}
+	parts := strings.Split(query, `"`)
+	for i, part := range parts {
+		if i%2 == 1 {
+			if phrase := strings.ToLower(strings.TrimSpace(part)); phrase != "" {
+				m.phrases = append(m.phrases, phrase)
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			if strings.HasPrefix(field, "-") {
+				continue
+			}
+			for _, word := range words(field) {
+				m.terms[stem(word)] = true
+			}
+		}
+	}
+	return m
+}
+
+func (m *searchMatcher) matches(text string) bool {
+	lower := strings.ToLower(text)
+	for _, phrase := range m.phrases {
+		if strings.Contains(lower, phrase) {
+			return true
+		}
+	}
+	for _, word := range words(lower) {
+		if m.terms[stem(word)] {
+			return true
+		}
+	}
+	return false
+}
+
+// snippets lists up to maxSnippets matches, transcript sentences first as
+// they are what the player can jump to.
+func (m *searchMatcher) snippets(conversation models.Conversation) []SearchSnippet {
+	snippets := []SearchSnippet{}
+	add := func(snippet SearchSnippet) bool {
+		snippets = append(snippets, snippet)
+		return len(snippets) < maxSnippets
+	}
+
+	for i, sentence := range conversation.Transcript {
+		if !m.matches(sentence.Sentence) {
+			continue
+		}
+		index, start, end := i, sentence.Start, sentence.End
+		if !add(SearchSnippet{
+			Field:         "transcript",
+			Text:          sentence.Sentence,
+			SentenceIndex: &index,
+			Speaker:       sentence.Speaker,
+			SpeakerName:   sentence.SpeakerName,
+			Start:         &start,
+			End:           &end,
+		}) {
+			return snippets
+		}
+	}
+
+	if m.matches(conversation.Name) && !add(SearchSnippet{Field: "name", Text: conversation.Name}) {
+		return snippets
+	}
+	if m.matches(conversation.Summary) && !add(SearchSnippet{Field: "summary", Text: conversation.Summary}) {
+		return snippets
+	}
+	for _, item := range conversation.ActionItems {
+		if m.matches(item) && !add(SearchSnippet{Field: "action_items", Text: item}) {
+			return snippets
+		}
+	}
+	for _, message := range conversation.ChatHistory {
+		if m.matches(message.Content) && !add(SearchSnippet{Field: "chat_history", Text: message.Content}) {
+			return snippets
+		}
+	}
+	return snippets
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+func stem(word string) string {
+	word = strings.TrimSuffix(word, "'s")
+	for _, suffixes := range [][]string{{"es", "s"}, {"ing", "ed"}} {
+		for _, suffix := range suffixes {
+			if len(word)-len(suffix) >= 3 && strings.HasSuffix(word, suffix) {
+				word = strings.TrimSuffix(word, suffix)
+				break
+			}
+		}
+	}
+	return word
+}
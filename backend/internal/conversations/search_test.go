@@ -0,0 +1,101 @@
+package conversations
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"meetings", "meet"},
+		{"meeting", "meet"},
+		{"matches", "match"},
+		{"boxes", "box"},
+		{"bus", "bus"},
+		{"sing", "sing"},
+		{"john's", "john"},
+		{"planned", "plann"},
+		{"planning", "plann"},
+	}
+	for _, test := range tests {
+		if got := stem(test.word); got != test.want {
+			t.Errorf("stem(%q) = %q, want %q", test.word, got, test.want)
+		}
+	}
+}
+
+func TestSearchMatcher(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+		want  bool
+	}{
+		{"budget", "The Budget is due", true},
+		{"budgets", "about the budget.", true},
+		{"planning", "we planned it", true},
+		{"budget", "budgetary concerns", false},
+		{`"next week"`, "See you Next Week!", true},
+		{`"next week"`, "next month, not this week", false},
+		{`launch "next week"`, "the launch", true},
+		{"-budget", "the budget", false},
+		{"budget -draft", "the draft", false},
+		{"don't", "I don't know", true},
+		{"", "anything", false},
+	}
+	for _, test := range tests {
+		if got := newSearchMatcher(test.query).matches(test.text); got != test.want {
+			t.Errorf("query %q matches %q = %v, want %v", test.query, test.text, got, test.want)
+		}
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	conversation := models.Conversation{
+		Name:        "Budget review",
+		Summary:     "Went over the budget",
+		ActionItems: []string{"Send budget", "Book room"},
+		ChatHistory: []models.ChatMessage{{Content: "what was the budget?"}},
+		Transcript: []models.TranscriptionSentence{
+			{Sentence: "Hello", Start: 0, End: 1, Speaker: "0"},
+			{Sentence: "The budget is tight", Start: 1, End: 3, Speaker: "1", SpeakerName: "Ana"},
+		},
+	}
+	describe := func(snippets []SearchSnippet) string {
+		parts := make([]string, len(snippets))
+		for i, s := range snippets {
+			parts[i] = s.Field + ":" + s.Text
+			if s.SentenceIndex != nil {
+				parts[i] += fmt.Sprintf("@%d[%g-%g]%s", *s.SentenceIndex, *s.Start, *s.End, s.SpeakerName)
+			}
+		}
+		return strings.Join(parts, " | ")
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"budget", "transcript:The budget is tight@1[1-3]Ana | name:Budget review | summary:Went over the budget | action_items:Send budget | chat_history:what was the budget?"},
+		{"room", "action_items:Book room"},
+		{"hello review", "transcript:Hello@0[0-1] | name:Budget review"},
+		{"missing", ""},
+	}
+	for _, test := range tests {
+		if got := describe(newSearchMatcher(test.query).snippets(conversation)); got != test.want {
+			t.Errorf("snippets for %q:\n got %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		conversation.Transcript = append(conversation.Transcript, models.TranscriptionSentence{Sentence: "budget again"})
+	}
+	if got := newSearchMatcher("budget").snippets(conversation); len(got) != maxSnippets || got[maxSnippets-1].Field != "transcript" {
+		t.Errorf("snippets for many matches = %s, want %d transcript snippets", describe(got), maxSnippets)
+	}
+}
@@ -0,0 +1,255 @@
+package dates
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Day is a date found in text, at midnight UTC.
+type Day struct {
+	Date time.Time
+	// Index and Text locate the expression in the text.
+	Index int
+	Text  string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+var numbers = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+const (
+	weekdayPattern = `(sunday|monday|tuesday|wednesday|thursday|friday|saturday)`
+	monthPattern   = `(jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sept?(?:ember)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\b\.?`
+)
+
+// dayPatterns are tried in order; where several match, the earliest in the
+// text wins.
+var dayPatterns = []struct {
+	pattern *regexp.Regexp
+	resolve func(m []string, ref time.Time) (time.Time, bool)
+}{
+	{regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`), func(m []string, ref time.Time) (time.Time, bool) {
+		return date(atoi(m[1]), time.Month(atoi(m[2])), atoi(m[3]))
+	}},
+	{regexp.MustCompile(`\b` + monthPattern + `\s+(\d{1,2})(?:st|nd|rd|th)?\b(?:,?\s+(\d{4})\b)?`), func(m []string, ref time.Time) (time.Time, bool) {
+		return monthDay(ref, months[m[1][:3]], atoi(m[2]), m[3])
+	}},
+	{regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?` + monthPattern + `(?:,?\s+(\d{4})\b)?`), func(m []string, ref time.Time) (time.Time, bool) {
+		return monthDay(ref, months[m[2][:3]], atoi(m[1]), m[3])
+	}},
+	{regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})(?:/(\d{4}))?\b`), func(m []string, ref time.Time) (time.Time, bool) {
+		return monthDay(ref, time.Month(atoi(m[1])), atoi(m[2]), m[3])
+	}},
+	{regexp.MustCompile(`\b(?:the\s+)?day\s+after\s+tomorrow\b`), func(m []string, ref time.Time) (time.Time, bool) {
+		return midnight(ref).AddDate(0, 0, 2), true
+	}},
+	{regexp.MustCompile(`\b(today|tonight|tomorrow)\b`), func(m []string, ref time.Time) (time.Time, bool) {
+		if m[1] == "tomorrow" {
+			return midnight(ref).AddDate(0, 0, 1), true
+		}
+		return midnight(ref), true
+	}},
+	{regexp.MustCompile(`\b(next|this|on|by|until)?\s*` + weekdayPattern + `\b`), func(m []string, ref time.Time) (time.Time, bool) {
+		return weekday(ref, weekdays[m[2]], m[1] == "next"), true
+	}},
+	{regexp.MustCompile(`\bin\s+(\d+|a|an|one|two|three|four|five|six|seven|eight|nine|ten)\s+(day|week|month)s?\b`), func(m []string, ref time.Time) (time.Time, bool) {
+		n, ok := numbers[m[1]]
+		if !ok {
+			n = atoi(m[1])
+		}
+		switch m[2] {
+		case "week":
+			return midnight(ref).AddDate(0, 0, 7*n), true
+		case "month":
+			return midnight(ref).AddDate(0, n, 0), true
+		}
+		return midnight(ref).AddDate(0, 0, n), true
+	}},
+	{regexp.MustCompile(`\b(?:the\s+)?end\s+of\s+(?:the\s+|this\s+)?(week|month)\b`), func(m []string, ref time.Time) (time.Time, bool) {
+		if m[1] == "month" {
+			first := time.Date(ref.Year(), ref.Month(), 1, 0, 0, 0, 0, time.UTC)
+			return first.AddDate(0, 1, -1), true
+		}
+		return weekday(ref.AddDate(0, 0, -1), time.Friday, false), true
+	}},
+	{regexp.MustCompile(`\bnext\s+(week|month)\b`), func(m []string, ref time.Time) (time.Time, bool) {
+		if m[1] == "month" {
+			return time.Date(ref.Year(), ref.Month()+1, 1, 0, 0, 0, 0, time.UTC), true
+		}
+		return weekday(ref, time.Monday, false), true
+	}},
+}
+
+// FindDay returns the first date mentioned in text, resolving relative
+// expressions ("tomorrow", "by Friday", "next week", "in two days") against
+// ref and dates without a year to their next occurrence. They are resolved
+// in ref's time zone, so pass ref in the speaker's zone: late on Monday in
+// New York, "tomorrow" is Tuesday even though it is already Tuesday in UTC.
+func FindDay(text string, ref time.Time) (Day, bool) {
+	lower := strings.ToLower(text)
+	// From here on ref's wall clock is read as UTC, as the date found is.
+	ref = time.Date(ref.Year(), ref.Month(), ref.Day(), ref.Hour(), ref.Minute(), ref.Second(), ref.Nanosecond(), time.UTC)
+	var found Day
+	ok := false
+	for _, p := range dayPatterns {
+		for _, loc := range p.pattern.FindAllStringSubmatchIndex(lower, -1) {
+			if ok && loc[0] >= found.Index {
+				break
+			}
+			m := submatches(lower, loc)
+			date, valid := p.resolve(m, ref)
+			if !valid {
+				continue
+			}
+			found = Day{Date: date, Index: loc[0], Text: strings.TrimSpace(text[loc[0]:loc[1]])}
+			ok = true
+			break
+		}
+	}
+	return found, ok
+}
+
+func submatches(s string, loc []int) []string {
+	m := make([]string, len(loc)/2)
+	for i := range m {
+		if loc[2*i] >= 0 {
+			m[i] = s[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return m
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// weekday returns the next day after ref falling on day. With next, a day
+// still in ref's week (weeks start on Monday) is moved on by a week.
+func weekday(ref time.Time, day time.Weekday, next bool) time.Time {
+	days := (int(day) - int(ref.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	if next && days <= 7-isoWeekday(ref) {
+		days += 7
+	}
+	return midnight(ref).AddDate(0, 0, days)
+}
+
+// isoWeekday numbers Monday 1 through Sunday 7.
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+func monthDay(ref time.Time, month time.Month, day int, year string) (time.Time, bool) {
+	if year != "" {
+		return date(atoi(year), month, day)
+	}
+	t, ok := date(ref.Year(), month, day)
+	if ok && t.Before(midnight(ref)) {
+		t, ok = date(ref.Year()+1, month, day)
+	}
+	return t, ok
+}
+
+// date builds a date, rejecting ones that do not exist such as 31 April.
+func date(year int, month time.Month, day int) (time.Time, bool) {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if month < time.January || month > time.December || t.Day() != day || t.Month() != month {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// TimeOfDay is a time of day found in text.
+type TimeOfDay struct {
+	Hour   int
+	Minute int
+	Index  int
+	Text   string
+}
+
+// timePatterns are tried in order and the first that matches wins, so that
+// "at 3:30" is read as 3:30 rather than 3 o'clock.
+var timePatterns = []struct {
+	pattern *regexp.Regexp
+	resolve func(m []string) (int, int, bool)
+}{
+	{regexp.MustCompile(`\b(\d{1,2}):(\d{2})\b(?:\s*(am\b|pm\b|a\.m\.|p\.m\.))?`), func(m []string) (int, int, bool) {
+		return clock(atoi(m[1]), atoi(m[2]), m[3])
+	}},
+	{regexp.MustCompile(`\b(\d{1,2})\s*(am\b|pm\b|a\.m\.|p\.m\.)`), func(m []string) (int, int, bool) {
+		return clock(atoi(m[1]), 0, m[2])
+	}},
+	{regexp.MustCompile(`\b(noon|midday)\b`), func(m []string) (int, int, bool) {
+		return 12, 0, true
+	}},
+	{regexp.MustCompile(`\b(?:at|around|from)\s+(\d{1,2})(?:\s+o'clock)?\b([^:\d]|$)`), func(m []string) (int, int, bool) {
+		return clock(atoi(m[1]), 0, "")
+	}},
+}
+
+// FindTime returns the time of day mentioned in text. An hour without am or
+// pm is taken to be during working hours, so "at 3" is 15:00 and "at 9" is
+// 9:00.
+func FindTime(text string) (TimeOfDay, bool) {
+	lower := strings.ToLower(text)
+	for _, p := range timePatterns {
+		for _, loc := range p.pattern.FindAllStringSubmatchIndex(lower, -1) {
+			hour, minute, ok := p.resolve(submatches(lower, loc))
+			if !ok {
+				continue
+			}
+			matched := strings.TrimSpace(strings.TrimRight(text[loc[0]:loc[1]], ".,;!? "))
+			return TimeOfDay{Hour: hour, Minute: minute, Index: loc[0], Text: matched}, true
+		}
+	}
+	return TimeOfDay{}, false
+}
+
+func clock(hour, minute int, meridiem string) (int, int, bool) {
+	if minute > 59 {
+		return 0, 0, false
+	}
+	switch strings.ReplaceAll(meridiem, ".", "") {
+	case "am":
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		return hour % 12, minute, true
+	case "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		return hour%12 + 12, minute, true
+	}
+	if hour > 23 {
+		return 0, 0, false
+	}
+	if hour >= 1 && hour <= 7 {
+		hour += 12
+	}
+	return hour, minute, true
+}
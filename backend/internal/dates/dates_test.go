@@ -0,0 +1,128 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+// ref is a Friday afternoon.
+var ref = time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC)
+
+func TestFindDay(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // YYYY-MM-DD, or "" for no date
+		at   string // the matched expression
+	}{
+		{"Send the deck today", "2026-10-16", "today"},
+		{"call them tomorrow", "2026-10-17", "tomorrow"},
+		{"the day after tomorrow works", "2026-10-18", "the day after tomorrow"},
+		{"send the budget by Friday", "2026-10-23", "by Friday"},
+		{"see you Monday", "2026-10-19", "Monday"},
+		{"next Friday", "2026-10-23", "next Friday"},
+		{"next Monday", "2026-10-19", "next Monday"},
+		{"in two weeks", "2026-10-30", "in two weeks"},
+		{"in 3 days", "2026-10-19", "in 3 days"},
+		{"in a month", "2026-11-16", "in a month"},
+		{"by the end of the month", "2026-10-31", "the end of the month"},
+		{"by end of week", "2026-10-16", "end of week"},
+		{"sometime next week", "2026-10-19", "next week"},
+		{"next month", "2026-11-01", "next month"},
+		{"due 2026-11-02", "2026-11-02", "2026-11-02"},
+		{"on March 5th", "2027-03-05", "March 5th"},
+		{"on the 5th of March", "2027-03-05", "5th of March"},
+		{"Dec 24, 2026", "2026-12-24", "Dec 24, 2026"},
+		{"Sept 3", "2027-09-03", "Sept 3"},
+		{"by 10/20", "2026-10-20", "10/20"},
+		{"April 31", "", ""},
+		{"monday or tomorrow", "2026-10-19", "monday"},
+		{"tomorrow or monday", "2026-10-17", "tomorrow"},
+		{"nothing to schedule", "", ""},
+		{"the marching band", "", ""},
+	}
+	for _, test := range tests {
+		day, ok := FindDay(test.text, ref)
+		if test.want == "" {
+			if ok {
+				t.Errorf("FindDay(%q) = %s, want no date", test.text, day.Date.Format("2006-01-02"))
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("FindDay(%q) found no date, want %s", test.text, test.want)
+			continue
+		}
+		if got := day.Date.Format("2006-01-02"); got != test.want || day.Text != test.at {
+			t.Errorf("FindDay(%q) = %s from %q, want %s from %q", test.text, got, day.Text, test.want, test.at)
+		}
+	}
+}
+
+func TestFindTime(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // HH:MM, or "" for no time
+	}{
+		{"let's meet Thursday at 3", "15:00"},
+		{"call at 9.", "09:00"},
+		{"around 11 tomorrow", "11:00"},
+		{"at 3 o'clock", "15:00"},
+		{"at 3:30 pm", "15:30"},
+		{"at 3:30", "15:30"},
+		{"15:00 works", "15:00"},
+		{"10am standup", "10:00"},
+		{"at 9 a.m. sharp", "09:00"},
+		{"12 pm lunch", "12:00"},
+		{"12am deploy", "00:00"},
+		{"meet at noon", "12:00"},
+		{"let's meet friday, we have 3 amendments", ""},
+		{"call about the 2 ample rooms on monday", ""},
+		{"at 3:30 amendments are due", "15:30"},
+		{"we have 3 people", ""},
+		{"at 12:75", ""},
+		{"13pm", ""},
+	}
+	for _, test := range tests {
+		clock, ok := FindTime(test.text)
+		if test.want == "" {
+			if ok {
+				t.Errorf("FindTime(%q) = %02d:%02d, want no time", test.text, clock.Hour, clock.Minute)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("FindTime(%q) found no time, want %s", test.text, test.want)
+			continue
+		}
+		if got := time.Date(0, 1, 1, clock.Hour, clock.Minute, 0, 0, time.UTC).Format("15:04"); got != test.want {
+			t.Errorf("FindTime(%q) = %s, want %s", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFindDayTimeZone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	// Monday 22:00 in New York is already Tuesday in UTC.
+	said := time.Date(2026, 10, 19, 22, 0, 0, 0, newYork)
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"let's talk tomorrow", "2026-10-20"},
+		{"today", "2026-10-19"},
+		{"see you Wednesday", "2026-10-21"},
+	}
+	for _, test := range tests {
+		day, ok := FindDay(test.text, said)
+		if !ok {
+			t.Errorf("FindDay(%q) found no date, want %s", test.text, test.want)
+			continue
+		}
+		if got := day.Date.Format("2006-01-02"); got != test.want {
+			t.Errorf("FindDay(%q) = %s, want %s", test.text, got, test.want)
+		}
+	}
+}
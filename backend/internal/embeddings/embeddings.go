@@ -0,0 +1,122 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	ProviderHash   = "hash"
+	ProviderOpenAI = "openai"
+)
+
+// ErrUnauthorized is returned when an embedding provider rejects the key.
+var ErrUnauthorized = errors.New("embedding provider rejected the API key")
+
+// Provider turns texts into vectors. Vectors from different providers or
+// models are not comparable, so Model identifies both.
+type Provider interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewProvider returns the embedding provider selected in the user's stored
+// credentials. The hashing provider is the default, as it needs no key or
+// network access.
+func NewProvider(creds models.GCPCredentials) (Provider, error) {
+	switch creds.EmbeddingProvider {
+	case "", ProviderHash:
+		return hashProvider{}, nil
+	case ProviderOpenAI:
+		return newOpenAIProvider(creds.EmbeddingURL, creds.EmbeddingKey, creds.EmbeddingModel), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", creds.EmbeddingProvider)
+	}
+}
+
+// normalize scales v to unit length, so the dot product of two vectors is
+// their cosine similarity.
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+const (
+	// maxChunkWords and maxChunkDuration bound a passage, so that it is about
+	// one topic and short enough to show as a search result.
+	maxChunkWords    = 120
+	maxChunkDuration = 60.0
+)
+
+// Chunk splits a transcript into passages of consecutive sentences.
+func Chunk(transcript []models.TranscriptionSentence) []models.TranscriptChunk {
+	var chunks []models.TranscriptChunk
+	var current *models.TranscriptChunk
+	var text []string
+	words := 0
+	flush := func() {
+		if current != nil {
+			current.Text = strings.Join(text, " ")
+			chunks = append(chunks, *current)
+		}
+		current, text, words = nil, nil, 0
+	}
+
+	for i, sentence := range transcript {
+		sentenceText := strings.TrimSpace(sentence.Sentence)
+		if sentenceText == "" {
+			continue
+		}
+		sentenceWords := len(strings.Fields(sentenceText))
+		if current != nil && (words+sentenceWords > maxChunkWords || sentence.End-current.Start > maxChunkDuration) {
+			flush()
+		}
+		if current == nil {
+			current = &models.TranscriptChunk{FirstSentence: i, Start: sentence.Start, Speakers: []string{}}
+		}
+		current.LastSentence = i
+		current.End = sentence.End
+		if !contains(current.Speakers, sentence.Speaker) {
+			current.Speakers = append(current.Speakers, sentence.Speaker)
+		}
+		text = append(text, sentenceText)
+		words += sentenceWords
+	}
+	flush()
+	return chunks
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package embeddings
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const hashDimensions = 512
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true,
+	"by": true, "do": true, "for": true, "from": true, "have": true, "i": true, "in": true, "is": true,
+	"it": true, "of": true, "on": true, "or": true, "so": true, "that": true, "the": true, "this": true,
+	"to": true, "was": true, "we": true, "with": true, "you": true,
+}
+
+// hashProvider embeds text offline by hashing its words and word pairs into
+// a fixed number of dimensions. It finds passages sharing vocabulary with
+// the query, but unlike a trained model it does not know about synonyms.
+type hashProvider struct{}
+
+func (hashProvider) Model() string {
+	return ProviderHash
+}
+
+func (hashProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = hashEmbed(text)
+	}
+	return vectors, nil
+}
+
+func hashEmbed(text string) []float32 {
+	vector := make([]float32, hashDimensions)
+	counts := map[string]int{}
+	var previous string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if stopWords[word] {
+			continue
+		}
+		word = stem(word)
+		counts[word]++
+		if previous != "" {
+			counts[previous+" "+word]++
+		}
+		previous = word
+	}
+
+	for feature, count := range counts {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		weight := float32(1 + math.Log(float64(count)))
+		if sum&(1<<63) != 0 {
+			weight = -weight
+		}
+		vector[sum%hashDimensions] += weight
+	}
+	return normalize(vector)
+}
+
+func stem(word string) string {
+	for _, suffixes := range [][]string{{"es", "s"}, {"ing", "ed"}} {
+		for _, suffix := range suffixes {
+			if len(word)-len(suffix) >= 3 && strings.HasSuffix(word, suffix) {
+				word = strings.TrimSuffix(word, suffix)
+				break
+			}
+		}
+	}
+	return word
+}
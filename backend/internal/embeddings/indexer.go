@@ -0,0 +1,210 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// indexBatchSize is how many conversations per user are embedded in one
+// sweep, so one large account does not hold up the others.
+const indexBatchSize = 50
+
+// Indexer keeps the transcript chunks of every conversation embedded with
+// its owner's current embedding provider. A conversation is re-embedded
+// when it has changed since it was last embedded or the provider changed.
+type Indexer struct {
+	conversations *mongo.Collection
+	chunks        *mongo.Collection
+	credentials   *mongo.Collection
+	PollInterval  time.Duration
+}
+
+func NewIndexer(conversationsCollection, chunksCollection, gcpCredentialsCollection *mongo.Collection) *Indexer {
+	return &Indexer{
+		conversations: conversationsCollection,
+		chunks:        chunksCollection,
+		credentials:   gcpCredentialsCollection,
+		PollInterval:  time.Minute,
+	}
+}
+
+func EnsureIndexes(ctx context.Context, chunks *mongo.Collection) error {
+	_, err := chunks.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "model", Value: 1}}},
+		{Keys: bson.D{{Key: "conversation_id", Value: 1}}},
+	})
+	return err
+}
+
+// Run embeds changed conversations every PollInterval until ctx is
+// cancelled.
+func (ix *Indexer) Run(ctx context.Context) {
+	for {
+		ix.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ix.PollInterval):
+		}
+	}
+}
+
+func (ix *Indexer) sweep(ctx context.Context) {
+	userIDs, err := ix.conversations.Distinct(ctx, "user_id", bson.M{"deleted_at": nil})
+	if err != nil {
+		log.Printf("Error fetching users to embed: %v", err)
+		return
+	}
+	for _, value := range userIDs {
+		if userID, ok := value.(primitive.ObjectID); ok {
+			ix.indexUser(ctx, userID)
+		}
+	}
+}
+
+func (ix *Indexer) indexUser(ctx context.Context, userID primitive.ObjectID) {
+	provider, err := UserProvider(ctx, ix.credentials, userID)
+	if err != nil {
+		log.Printf("Error loading embedding provider for user %s: %v", userID.Hex(), err)
+		return
+	}
+	model := provider.Model()
+
+	cursor, err := ix.conversations.Find(ctx,
+		bson.M{
+			"user_id":    userID,
+			"deleted_at": nil,
+			"$or": []bson.M{
+				{"embedding_model": bson.M{"$ne": model}},
+				{"$expr": bson.M{"$lt": bson.A{"$embedded_at", "$updated_at"}}},
+			},
+		},
+		options.Find().
+			SetProjection(bson.M{"user_id": 1, "transcript": 1, "updated_at": 1}).
+			SetLimit(indexBatchSize),
+	)
+	if err != nil {
+		log.Printf("Error fetching conversations to embed: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var conversation models.Conversation
+		if err := cursor.Decode(&conversation); err != nil {
+			log.Printf("Error decoding conversation to embed: %v", err)
+			continue
+		}
+		if err := ix.index(ctx, provider, conversation); err != nil {
+			log.Printf("Error embedding conversation %s: %v", conversation.ID.Hex(), err)
+			if errors.Is(err, ErrUnauthorized) {
+				return
+			}
+		}
+	}
+}
+
+// index replaces the conversation's chunks with freshly embedded ones.
+// Changes that leave the passages as they were, such as a rename or a chat
+// message, only mark the conversation embedded.
+func (ix *Indexer) index(ctx context.Context, provider Provider, conversation models.Conversation) error {
+	chunks := Chunk(conversation.Transcript)
+	unchanged, err := ix.unchanged(ctx, conversation.ID, provider.Model(), chunks)
+	if err != nil {
+		return err
+	}
+	if unchanged {
+		return ix.markEmbedded(ctx, conversation, provider.Model())
+	}
+
+	if len(chunks) > 0 {
+		texts := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			texts[i] = chunk.Text
+		}
+		vectors, err := provider.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for i := range chunks {
+			chunks[i].UserID = conversation.UserID
+			chunks[i].ConversationID = conversation.ID
+			chunks[i].Model = provider.Model()
+			chunks[i].Vector = vectors[i]
+			chunks[i].CreatedAt = now
+		}
+	}
+
+	if _, err := ix.chunks.DeleteMany(ctx, bson.M{"conversation_id": conversation.ID}); err != nil {
+		return fmt.Errorf("error deleting old chunks: %v", err)
+	}
+	if len(chunks) > 0 {
+		documents := make([]interface{}, len(chunks))
+		for i, chunk := range chunks {
+			documents[i] = chunk
+		}
+		if _, err := ix.chunks.InsertMany(ctx, documents); err != nil {
+			return fmt.Errorf("error saving chunks: %v", err)
+		}
+	}
+
+	return ix.markEmbedded(ctx, conversation, provider.Model())
+}
+
+// unchanged reports whether the stored chunks of the conversation were
+// embedded by model from the same passages.
+func (ix *Indexer) unchanged(ctx context.Context, conversationID primitive.ObjectID, model string, chunks []models.TranscriptChunk) (bool, error) {
+	var stored []models.TranscriptChunk
+	cursor, err := ix.chunks.Find(ctx,
+		bson.M{"conversation_id": conversationID},
+		options.Find().SetProjection(bson.M{"model": 1, "text": 1, "first_sentence": 1}).SetSort(bson.M{"first_sentence": 1}),
+	)
+	if err != nil {
+		return false, fmt.Errorf("error fetching chunks: %v", err)
+	}
+	if err := cursor.All(ctx, &stored); err != nil {
+		return false, fmt.Errorf("error fetching chunks: %v", err)
+	}
+	if len(stored) != len(chunks) {
+		return false, nil
+	}
+	for i := range chunks {
+		if stored[i].Model != model || stored[i].Text != chunks[i].Text || stored[i].FirstSentence != chunks[i].FirstSentence {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (ix *Indexer) markEmbedded(ctx context.Context, conversation models.Conversation, model string) error {
+	_, err := ix.conversations.UpdateOne(ctx,
+		bson.M{"_id": conversation.ID},
+		bson.M{"$set": bson.M{"embedded_at": conversation.UpdatedAt, "embedding_model": model}},
+	)
+	if err != nil {
+		return fmt.Errorf("error marking conversation embedded: %v", err)
+	}
+	return nil
+}
+
+// UserProvider returns the embedding provider configured in the user's
+// stored credentials, or the default when they have none.
+func UserProvider(ctx context.Context, gcpCollection *mongo.Collection, userID primitive.ObjectID) (Provider, error) {
+	var creds models.GCPCredentials
+	err := gcpCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&creds)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error fetching credentials: %v", err)
+	}
+	return NewProvider(creds)
+}
@@ -0,0 +1,177 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	defaultSemanticResults = 10
+	maxSemanticResults     = 50
+)
+
+// Passage is a semantic search hit: a transcript chunk and how similar it
+// is to the query, from -1 to 1.
+type Passage struct {
+	ConversationID   primitive.ObjectID `json:"conversation_id"`
+	ConversationName string             `json:"conversation_name"`
+	Text             string             `json:"text"`
+	Speakers         []string           `json:"speakers"`
+	FirstSentence    int                `json:"first_sentence"`
+	LastSentence     int                `json:"last_sentence"`
+	Start            float64            `json:"start"`
+	End              float64            `json:"end"`
+	Score            float64            `json:"score"`
+}
+
+// Search returns the limit passages of the user's conversations closest to
+// the query, best first. Chunks are compared in memory. Only conversations
+// outside the trash that also match filter, if given, are searched.
+func Search(ctx context.Context, chunksCollection, conversationsCollection *mongo.Collection, provider Provider, userID primitive.ObjectID, query string, limit int, filter bson.M) ([]Passage, error) {
+	vectors, err := provider.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	queryVector := vectors[0]
+
+	conversationFilter := bson.M{"user_id": userID, "deleted_at": nil}
+	for key, value := range filter {
+		conversationFilter[key] = value
+	}
+	searchable := map[primitive.ObjectID]bool{}
+	ids, err := conversationsCollection.Distinct(ctx, "_id", conversationFilter)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if id, ok := id.(primitive.ObjectID); ok {
+			searchable[id] = true
+		}
+	}
+
+	cursor, err := chunksCollection.Find(ctx, bson.M{"user_id": userID, "model": provider.Model()})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	passages := []Passage{}
+	for cursor.Next(ctx) {
+		var chunk models.TranscriptChunk
+		if err := cursor.Decode(&chunk); err != nil {
+			return nil, err
+		}
+		if !searchable[chunk.ConversationID] {
+			continue
+		}
+		score := dot(queryVector, chunk.Vector)
+		if score <= 0 || (len(passages) == limit && score <= passages[limit-1].Score) {
+			continue
+		}
+		passage := Passage{
+			ConversationID: chunk.ConversationID,
+			Text:           chunk.Text,
+			Speakers:       chunk.Speakers,
+			FirstSentence:  chunk.FirstSentence,
+			LastSentence:   chunk.LastSentence,
+			Start:          chunk.Start,
+			End:            chunk.End,
+			Score:          score,
+		}
+		i := sort.Search(len(passages), func(i int) bool { return passages[i].Score < score })
+		passages = append(passages, Passage{})
+		copy(passages[i+1:], passages[i:])
+		passages[i] = passage
+		if len(passages) > limit {
+			passages = passages[:limit]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(passages) > 0 {
+		conversationIDs := make([]primitive.ObjectID, len(passages))
+		for i, passage := range passages {
+			conversationIDs[i] = passage.ConversationID
+		}
+		var conversations []models.Conversation
+		nameCursor, err := conversationsCollection.Find(ctx,
+			bson.M{"_id": bson.M{"$in": conversationIDs}, "user_id": userID},
+			options.Find().SetProjection(bson.M{"name": 1}),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := nameCursor.All(ctx, &conversations); err != nil {
+			return nil, err
+		}
+		names := map[primitive.ObjectID]string{}
+		for _, conversation := range conversations {
+			names[conversation.ID] = conversation.Name
+		}
+		for i := range passages {
+			passages[i].ConversationName = names[passages[i].ConversationID]
+		}
+	}
+	return passages, nil
+}
+
+// SemanticSearch finds the transcript passages closest in meaning to q, using
+// the user's embedding provider. limit caps the number of passages (default
+// 10, up to 50).
+func SemanticSearch(chunksCollection, conversationsCollection, gcpCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			http.Error(w, "Search query is required", http.StatusBadRequest)
+			return
+		}
+		limit := defaultSemanticResults
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxSemanticResults {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		provider, err := UserProvider(context.TODO(), gcpCollection, userID)
+		if err != nil {
+			http.Error(w, "Error loading embedding provider", http.StatusInternalServerError)
+			return
+		}
+		passages, err := Search(context.TODO(), chunksCollection, conversationsCollection, provider, userID, query, limit, nil)
+		if errors.Is(err, ErrUnauthorized) {
+			http.Error(w, "Embedding provider rejected the API key", http.StatusBadGateway)
+			return
+		}
+		if err != nil {
+			log.Printf("Error performing semantic search: %v", err)
+			http.Error(w, "Error performing search", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(passages)
+	}
+}
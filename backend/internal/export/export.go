@@ -0,0 +1,290 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/people"
+)
+
+// Caption cues are cut at word boundaries so that each stays readable: two
+// lines of about 42 characters shown for at most 7 seconds.
+const (
+	maxCueChars    = 84
+	maxCueDuration = 7.0
+)
+
+const (
+	FormatSRT      = "srt"
+	FormatVTT      = "vtt"
+	FormatMarkdown = "md"
+	FormatText     = "txt"
+	FormatJSON     = "json"
+)
+
+// Format describes how an export format is served.
+type Format struct {
+	Extension   string
+	ContentType string
+	render      func(w io.Writer, conversation models.Conversation) error
+}
+
+var Formats = map[string]Format{
+	FormatSRT:      {Extension: "srt", ContentType: "application/x-subrip; charset=utf-8", render: renderSRT},
+	FormatVTT:      {Extension: "vtt", ContentType: "text/vtt; charset=utf-8", render: renderVTT},
+	FormatMarkdown: {Extension: "md", ContentType: "text/markdown; charset=utf-8", render: renderMarkdown},
+	FormatText:     {Extension: "txt", ContentType: "text/plain; charset=utf-8", render: renderText},
+	FormatJSON:     {Extension: "json", ContentType: "application/json", render: renderJSON},
+}
+
+// Render writes the conversation in the given format. Speaker names should
+// already be resolved with people.Resolve; unnamed speakers are labelled
+// "Speaker <label>".
+func Render(w io.Writer, conversation models.Conversation, format string) error {
+	f, ok := Formats[format]
+	if !ok {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+	buffered := bufio.NewWriter(w)
+	if err := f.render(buffered, conversation); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._ -]+`)
+
+// FileName returns a download file name for the conversation.
+func FileName(conversation models.Conversation, format string) string {
+	name := strings.TrimSpace(unsafeFileChars.ReplaceAllString(conversation.Name, ""))
+	if name == "" {
+		name = "conversation-" + conversation.ID.Hex()
+	}
+	return name + "." + Formats[format].Extension
+}
+
+// ExportConversation serves GET /conversations/{id}/export?format= as a
+// download. The format defaults to txt.
+func ExportConversation(conversationsCollection, peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = FormatText
+		}
+		f, ok := Formats[format]
+		if !ok {
+			http.Error(w, "Unsupported format", http.StatusBadRequest)
+			return
+		}
+
+		var conversation models.Conversation
+		err = conversationsCollection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID}).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
+			return
+		}
+		if err := people.Resolve(context.TODO(), peopleCollection, &conversation); err != nil {
+			log.Printf("Error resolving speaker names: %v", err)
+		}
+
+		w.Header().Set("Content-Type", f.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": FileName(conversation, format)}))
+		if err := Render(w, conversation, format); err != nil {
+			log.Printf("Error exporting conversation %s: %v", conversationID.Hex(), err)
+		}
+	}
+}
+
+type cue struct {
+	start, end float64
+	speaker    string
+	text       string
+}
+
+// cues splits the transcript into caption cues, using word timings where the
+// provider gave them.
+func cues(conversation models.Conversation) []cue {
+	var result []cue
+	for _, sentence := range conversation.Transcript {
+		speaker := SpeakerName(sentence)
+		if len(sentence.Words) == 0 {
+			result = append(result, cue{sentence.Start, sentence.End, speaker, strings.TrimSpace(sentence.Sentence)})
+			continue
+		}
+
+		var current *cue
+		for _, word := range sentence.Words {
+			text := strings.TrimSpace(word.Word)
+			if text == "" {
+				continue
+			}
+			if current != nil && (len(current.text)+1+len(text) > maxCueChars || word.End-current.start > maxCueDuration) {
+				result = append(result, *current)
+				current = nil
+			}
+			if current == nil {
+				current = &cue{start: word.Start, end: word.End, speaker: speaker, text: text}
+				continue
+			}
+			current.text += " " + text
+			current.end = word.End
+		}
+		if current != nil {
+			result = append(result, *current)
+		}
+	}
+	return result
+}
+
+func renderSRT(w io.Writer, conversation models.Conversation) error {
+	for i, c := range cues(conversation) {
+		_, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s: %s\n\n", i+1, timestamp(c.start, ","), timestamp(c.end, ","), c.speaker, c.text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderVTT(w io.Writer, conversation models.Conversation) error {
+	if _, err := io.WriteString(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for _, c := range cues(conversation) {
+		speaker := strings.NewReplacer(">", "", "&", "&amp;").Replace(c.speaker)
+		_, err := fmt.Fprintf(w, "%s --> %s\n<v %s>%s\n\n", timestamp(c.start, "."), timestamp(c.end, "."), speaker, escapeVTT(c.text))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderMarkdown(w io.Writer, conversation models.Conversation) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title(conversation))
+	fmt.Fprintf(&b, "_%s_\n\n", conversation.CreatedAt.UTC().Format(time.RFC1123))
+	if conversation.Summary != "" {
+		fmt.Fprintf(&b, "## Summary\n\n%s\n\n", conversation.Summary)
+	}
+	if len(conversation.ActionItems) > 0 {
+		b.WriteString("## Action items\n\n")
+		for _, item := range conversation.ActionItems {
+			fmt.Fprintf(&b, "- [ ] %s\n", item)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("## Transcript\n\n")
+	for _, sentence := range conversation.Transcript {
+		fmt.Fprintf(&b, "**%s** [%s]: %s\n\n", SpeakerName(sentence), Clock(sentence.Start), strings.TrimSpace(sentence.Sentence))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func renderText(w io.Writer, conversation models.Conversation) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s\n\n", title(conversation), conversation.CreatedAt.UTC().Format(time.RFC1123))
+	if conversation.Summary != "" {
+		fmt.Fprintf(&b, "Summary\n\n%s\n\n", conversation.Summary)
+	}
+	if len(conversation.ActionItems) > 0 {
+		b.WriteString("Action items\n\n")
+		for _, item := range conversation.ActionItems {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Transcript\n\n")
+	for _, sentence := range conversation.Transcript {
+		fmt.Fprintf(&b, "[%s] %s: %s\n", Clock(sentence.Start), SpeakerName(sentence), strings.TrimSpace(sentence.Sentence))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func renderJSON(w io.Writer, conversation models.Conversation) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]interface{}{
+		"id":           conversation.ID,
+		"name":         conversation.Name,
+		"created_at":   conversation.CreatedAt,
+		"summary":      conversation.Summary,
+		"action_items": conversation.ActionItems,
+		"analysis":     conversation.Analysis,
+		"metadata":     conversation.Metadata,
+		"speakers":     conversation.Speakers,
+		"transcript":   conversation.Transcript,
+	})
+}
+
+func title(conversation models.Conversation) string {
+	if conversation.Name == "" {
+		return "Conversation"
+	}
+	return conversation.Name
+}
+
+// SpeakerName is the name of the person assigned to the sentence's speaker,
+// or "Speaker <label>".
+func SpeakerName(sentence models.TranscriptionSentence) string {
+	if sentence.SpeakerName != "" {
+		return sentence.SpeakerName
+	}
+	return "Speaker " + sentence.Speaker
+}
+
+// timestamp formats seconds as HH:MM:SS followed by sep and milliseconds,
+// as used by SRT (",") and WebVTT (".").
+func timestamp(seconds float64, sep string) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// Clock formats seconds as H:MM:SS, or MM:SS under an hour.
+func Clock(seconds float64) string {
+	s := int64(seconds)
+	if s < 0 {
+		s = 0
+	}
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+func escapeVTT(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
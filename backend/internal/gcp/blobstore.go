@@ -0,0 +1,62 @@
+package gcp
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	BackendGCS   = "gcs"
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ArchivePrefix is where account archives are kept in a user's storage.
+// Objects under it are not audio and are never imported as conversations.
+const ArchivePrefix = "omi-archives/"
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a single object in a user's bucket.
+type ObjectInfo struct {
+	Name        string
+	Size        int64
+	ContentType string
+	Created     time.Time
+	Updated     time.Time
+}
+
+// BlobStore is the storage backend holding a user's audio files.
+type BlobStore interface {
+	List(ctx context.Context) ([]ObjectInfo, error)
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	Put(ctx context.Context, name string, r io.Reader, contentType string) error
+	Delete(ctx context.Context, name string) error
+	SignURL(ctx context.Context, name string, expires time.Duration) (string, error)
+	Close() error
+}
+
+// OpenBlobStore returns the backend selected by the user's stored credentials.
+// An empty backend is treated as GCS so existing credentials keep working.
+func OpenBlobStore(ctx context.Context, creds models.GCPCredentials) (BlobStore, error) {
+	switch creds.StorageBackend {
+	case "", BackendGCS:
+		jsonCreds, err := base64.StdEncoding.DecodeString(creds.Credentials)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding GCP credentials: %v", err)
+		}
+		return newGCSStore(ctx, jsonCreds, creds.BucketName)
+	case BackendLocal:
+		return newLocalStore(creds.UserID, creds.BucketName)
+	case BackendS3:
+		return newS3Store(creds)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", creds.StorageBackend)
+	}
+}
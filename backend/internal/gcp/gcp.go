@@ -2,7 +2,6 @@ package gcp
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,25 +13,69 @@ import (
 	"strings"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"google.golang.org/api/iterator"
-	"google.golang.org/api/option"
 
 	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/embeddings"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/jobs"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/llm"
 	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
 	"github.com/TheLickIn13Keys/omi-webapp/internal/transcription"
 )
 
+// credentialsUpdate holds the fields of a credentials request. Fields left
+// out of the request are nil and keep their stored value, so clients that
+// only know some settings do not clear the others.
+type credentialsUpdate struct {
+	UserID         primitive.ObjectID `json:"-" bson:"user_id"`
+	StorageBackend *string            `json:"storage_backend" bson:"storage_backend,omitempty"`
+	Credentials    *string            `json:"credentials" bson:"credentials,omitempty"`
+	BucketName     *string            `json:"bucket_name" bson:"bucket_name,omitempty"`
+	S3Endpoint     *string            `json:"s3_endpoint" bson:"s3_endpoint,omitempty"`
+	S3Region       *string            `json:"s3_region" bson:"s3_region,omitempty"`
+	S3AccessKey    *string            `json:"s3_access_key" bson:"s3_access_key,omitempty"`
+	S3SecretKey    *string            `json:"s3_secret_key" bson:"s3_secret_key,omitempty"`
+	S3Insecure     *bool              `json:"s3_insecure" bson:"s3_insecure,omitempty"`
+	GladiaKey      *string            `json:"gladia_key" bson:"gladia_key,omitempty"`
+
+	TranscriptionProvider *string `json:"transcription_provider" bson:"transcription_provider,omitempty"`
+	WhisperURL            *string `json:"whisper_url" bson:"whisper_url,omitempty"`
+	WhisperKey            *string `json:"whisper_key" bson:"whisper_key,omitempty"`
+	WhisperModel          *string `json:"whisper_model" bson:"whisper_model,omitempty"`
+
+	EmbeddingProvider *string `json:"embedding_provider" bson:"embedding_provider,omitempty"`
+	EmbeddingURL      *string `json:"embedding_url" bson:"embedding_url,omitempty"`
+	EmbeddingKey      *string `json:"embedding_key" bson:"embedding_key,omitempty"`
+	EmbeddingModel    *string `json:"embedding_model" bson:"embedding_model,omitempty"`
+
+	LLMProvider *string `json:"llm_provider" bson:"llm_provider,omitempty"`
+	LLMURL      *string `json:"llm_url" bson:"llm_url,omitempty"`
+	LLMKey      *string `json:"llm_key" bson:"llm_key,omitempty"`
+	LLMModel    *string `json:"llm_model" bson:"llm_model,omitempty"`
+}
+
+// valueOf returns the value of an optional request field, or "" if absent.
+func valueOf(field *string) string {
+	if field == nil {
+		return ""
+	}
+	return *field
+}
+
+// SaveGCPCredentials saves the user's storage and provider settings. Only
+// the fields present in the request are changed.
 func SaveGCPCredentials(collection *mongo.Collection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		var creds models.GCPCredentials
-		_ = json.NewDecoder(r.Body).Decode(&creds)
+		var creds credentialsUpdate
+		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
 
 		userID, err := auth.GetUserIDFromRequest(r)
 		if err != nil {
@@ -40,6 +83,34 @@ func SaveGCPCredentials(collection *mongo.Collection) http.HandlerFunc {
 			return
 		}
 
+		switch valueOf(creds.StorageBackend) {
+		case "", BackendGCS, BackendLocal, BackendS3:
+		default:
+			http.Error(w, "Unknown storage backend", http.StatusBadRequest)
+			return
+		}
+
+		switch valueOf(creds.TranscriptionProvider) {
+		case "", transcription.ProviderGladia, transcription.ProviderWhisper, transcription.ProviderFake:
+		default:
+			http.Error(w, "Unknown transcription provider", http.StatusBadRequest)
+			return
+		}
+
+		switch valueOf(creds.EmbeddingProvider) {
+		case "", embeddings.ProviderHash, embeddings.ProviderOpenAI:
+		default:
+			http.Error(w, "Unknown embedding provider", http.StatusBadRequest)
+			return
+		}
+
+		switch valueOf(creds.LLMProvider) {
+		case "", llm.ProviderFake, llm.ProviderOpenAI:
+		default:
+			http.Error(w, "Unknown LLM provider", http.StatusBadRequest)
+			return
+		}
+
 		creds.UserID = userID
 
 		_, err = collection.UpdateOne(
@@ -58,6 +129,22 @@ func SaveGCPCredentials(collection *mongo.Collection) http.HandlerFunc {
 	}
 }
 
+// OpenUserBlobStore loads the user's stored credentials and opens the storage
+// backend they select. Callers must Close the returned store.
+func OpenUserBlobStore(ctx context.Context, gcpCollection *mongo.Collection, userID primitive.ObjectID) (BlobStore, models.GCPCredentials, error) {
+	var creds models.GCPCredentials
+	err := gcpCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&creds)
+	if err != nil {
+		return nil, creds, fmt.Errorf("error fetching GCP credentials: %w", err)
+	}
+
+	store, err := OpenBlobStore(ctx, creds)
+	if err != nil {
+		return nil, creds, err
+	}
+	return store, creds, nil
+}
+
 func GetConversationAudio(gcpCollection, conversationsCollection *mongo.Collection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -84,37 +171,16 @@ func GetConversationAudio(gcpCollection, conversationsCollection *mongo.Collecti
 			return
 		}
 
-		var creds models.GCPCredentials
-		err = gcpCollection.FindOne(context.TODO(), bson.M{"user_id": userID}).Decode(&creds)
+		ctx := context.Background()
+		store, _, err := OpenUserBlobStore(ctx, gcpCollection, userID)
 		if err != nil {
-			log.Printf("Error fetching GCP credentials: %v", err)
+			log.Printf("Error opening storage backend: %v", err)
 			http.Error(w, "GCP credentials not found", http.StatusNotFound)
 			return
 		}
+		defer store.Close()
 
-		jsonCreds, err := base64.StdEncoding.DecodeString(creds.Credentials)
-		if err != nil {
-			log.Printf("Error decoding GCP credentials: %v", err)
-			http.Error(w, "Invalid GCP credentials", http.StatusInternalServerError)
-			return
-		}
-
-		var parsedCreds struct {
-			ClientEmail string `json:"client_email"`
-			PrivateKey  string `json:"private_key"`
-		}
-		if err := json.Unmarshal(jsonCreds, &parsedCreds); err != nil {
-			log.Printf("Error parsing GCP credentials: %v", err)
-			http.Error(w, "Invalid GCP credentials format", http.StatusInternalServerError)
-			return
-		}
-
-		url, err := storage.SignedURL(creds.BucketName, conversation.AudioFile.Name, &storage.SignedURLOptions{
-			GoogleAccessID: parsedCreds.ClientEmail,
-			PrivateKey:     []byte(parsedCreds.PrivateKey),
-			Method:         "GET",
-			Expires:        time.Now().Add(15 * time.Minute),
-		})
+		url, err := store.SignURL(ctx, conversation.AudioFile.Name, 15*time.Minute)
 		if err != nil {
 			log.Printf("Error generating signed URL: %v", err)
 			http.Error(w, "Failed to generate signed URL", http.StatusInternalServerError)
@@ -128,7 +194,7 @@ func GetConversationAudio(gcpCollection, conversationsCollection *mongo.Collecti
 		})
 	}
 }
-func QueryBucket(gcpCollection, conversationsCollection *mongo.Collection) http.HandlerFunc {
+func QueryBucket(gcpCollection, conversationsCollection *mongo.Collection, queue *jobs.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
@@ -138,51 +204,27 @@ func QueryBucket(gcpCollection, conversationsCollection *mongo.Collection) http.
 			return
 		}
 
-		var creds models.GCPCredentials
-		err = gcpCollection.FindOne(context.TODO(), bson.M{"user_id": userID}).Decode(&creds)
+		ctx := context.Background()
+		store, _, err := OpenUserBlobStore(ctx, gcpCollection, userID)
 		if err != nil {
+			log.Printf("Error opening storage backend: %v", err)
 			http.Error(w, "GCP credentials not found", http.StatusNotFound)
 			return
 		}
+		defer store.Close()
 
-		jsonCreds, err := base64.StdEncoding.DecodeString(creds.Credentials)
+		objects, err := store.List(ctx)
 		if err != nil {
-			http.Error(w, "Invalid GCP credentials", http.StatusInternalServerError)
-			return
-		}
-
-		var parsedCreds struct {
-			ClientEmail string `json:"client_email"`
-			PrivateKey  string `json:"private_key"`
-		}
-		if err := json.Unmarshal(jsonCreds, &parsedCreds); err != nil {
-			http.Error(w, "Invalid GCP credentials format", http.StatusInternalServerError)
+			http.Error(w, "Error listing bucket objects", http.StatusInternalServerError)
 			return
 		}
 
-		ctx := context.Background()
-		client, err := storage.NewClient(ctx, option.WithCredentialsJSON(jsonCreds))
-		if err != nil {
-			http.Error(w, "Failed to create GCP storage client", http.StatusInternalServerError)
-			return
-		}
-		defer client.Close()
-
-		bucket := client.Bucket(creds.BucketName)
-		it := bucket.Objects(ctx, nil)
-
 		newConversations := []models.Conversation{}
 
-		for {
-			attrs, err := it.Next()
-			if err == iterator.Done {
-				break
-			}
-			if err != nil {
-				http.Error(w, "Error listing bucket objects", http.StatusInternalServerError)
-				return
+		for _, attrs := range objects {
+			if strings.HasPrefix(attrs.Name, ArchivePrefix) {
+				continue
 			}
-
 			var existingConversation models.Conversation
 			err = conversationsCollection.FindOne(context.TODO(), bson.M{"user_id": userID, "audio_file.name": attrs.Name}).Decode(&existingConversation)
 			if err == mongo.ErrNoDocuments {
@@ -194,7 +236,7 @@ func QueryBucket(gcpCollection, conversationsCollection *mongo.Collection) http.
 						Name: attrs.Name,
 						URL:  "",
 					},
-					Transcript: []models.TranscriptionSentence{{Sentence: "Processing transcription..."}},
+					Transcript: []models.TranscriptionSentence{},
 					CreatedAt:  attrs.Created,
 					UpdatedAt:  attrs.Updated,
 				}
@@ -206,13 +248,22 @@ func QueryBucket(gcpCollection, conversationsCollection *mongo.Collection) http.
 				}
 
 				newConversation.ID = result.InsertedID.(primitive.ObjectID)
-				newConversations = append(newConversations, newConversation)
 
-				go initiateTranscription(conversationsCollection, gcpCollection, newConversation.ID, jsonCreds, creds)
+				job, err := queue.Enqueue(ctx, userID, newConversation.ID)
+				if err != nil {
+					log.Printf("Error queuing transcription: %v", err)
+				} else {
+					newConversation.TranscriptionStatus = job.State
+				}
+				newConversations = append(newConversations, newConversation)
 			} else if err == nil {
 
-				if len(existingConversation.Transcript) == 0 || (len(existingConversation.Transcript) == 1 && existingConversation.Transcript[0].Sentence == "Processing transcription...") {
-					go initiateTranscription(conversationsCollection, gcpCollection, existingConversation.ID, jsonCreds, creds)
+				// Conversations created before the job queue existed have no
+				// status; only those still lacking a transcript are queued.
+				if existingConversation.TranscriptionStatus == "" && needsTranscription(existingConversation) {
+					if _, err := queue.Enqueue(ctx, userID, existingConversation.ID); err != nil {
+						log.Printf("Error queuing transcription: %v", err)
+					}
 				}
 			}
 		}
@@ -223,74 +274,18 @@ func QueryBucket(gcpCollection, conversationsCollection *mongo.Collection) http.
 	}
 }
 
-func initiateTranscription(conversationsCollection, gcpCollection *mongo.Collection, conversationID primitive.ObjectID, jsonCreds []byte, creds models.GCPCredentials) {
-	maxRetries := 3
-	for i := 0; i < maxRetries; i++ {
-		var conversation models.Conversation
-		err := conversationsCollection.FindOne(context.TODO(), bson.M{"_id": conversationID}).Decode(&conversation)
-		if err != nil {
-			log.Printf("Error fetching conversation: %v", err)
-			return
-		}
-
-		signedURL, err := generateSignedURL(jsonCreds, creds.BucketName, conversation.AudioFile.Name)
-		if err != nil {
-			log.Printf("Error generating signed URL: %v", err)
-			return
-		}
-
-		transcript, summary, actionItems, err := transcription.TranscribeAudio(signedURL, creds.GladiaKey)
-		if err != nil {
-			log.Printf("Error transcribing audio (attempt %d): %v", i+1, err)
-			if i == maxRetries-1 {
-				transcript = []models.TranscriptionSentence{{Sentence: "Error transcribing audio after multiple attempts"}}
-				summary = "Error generating summary"
-				actionItems = []string{"Error generating action items"}
-			} else {
-				time.Sleep(time.Duration(i+1) * 5 * time.Second)
-				continue
-			}
-		}
-
-		_, err = conversationsCollection.UpdateOne(
-			context.TODO(),
-			bson.M{"_id": conversationID},
-			bson.M{"$set": bson.M{
-				"transcript":   transcript,
-				"summary":      summary,
-				"action_items": actionItems,
-				"updated_at":   time.Now(),
-			}},
-		)
-		if err != nil {
-			log.Printf("Error updating conversation with transcription: %v", err)
-		}
-
-		if err == nil {
-			break
-		}
-	}
+func needsTranscription(conversation models.Conversation) bool {
+	transcript := conversation.Transcript
+	return len(transcript) == 0 || (len(transcript) == 1 && transcript[0].Sentence == "Processing transcription...")
 }
 
 func UploadAudio(gcpCredentialsCollection *mongo.Collection, userID primitive.ObjectID, localFilePath, filename string) (string, error) {
-
-	var gcpCreds models.GCPCredentials
-	err := gcpCredentialsCollection.FindOne(context.TODO(), bson.M{"user_id": userID}).Decode(&gcpCreds)
-	if err != nil {
-		return "", fmt.Errorf("error fetching GCP credentials: %v", err)
-	}
-
-	jsonCreds, err := base64.StdEncoding.DecodeString(gcpCreds.Credentials)
-	if err != nil {
-		return "", fmt.Errorf("error decoding GCP credentials: %v", err)
-	}
-
 	ctx := context.Background()
-	client, err := storage.NewClient(ctx, option.WithCredentialsJSON(jsonCreds))
+	store, _, err := OpenUserBlobStore(ctx, gcpCredentialsCollection, userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCP storage client: %v", err)
+		return "", err
 	}
-	defer client.Close()
+	defer store.Close()
 
 	f, err := os.Open(localFilePath)
 	if err != nil {
@@ -303,40 +298,11 @@ func UploadAudio(gcpCredentialsCollection *mongo.Collection, userID primitive.Ob
 		contentType = "audio/mpeg"
 	}
 
-	bucket := client.Bucket(gcpCreds.BucketName)
-	obj := bucket.Object(filename)
-	wc := obj.NewWriter(ctx)
-	wc.ContentType = contentType
-	if _, err = io.Copy(wc, f); err != nil {
-		return "", fmt.Errorf("failed to copy file to GCP: %v", err)
-	}
-	if err := wc.Close(); err != nil {
-		return "", fmt.Errorf("failed to close GCP writer: %v", err)
-	}
-
-	url, err := generateSignedURL(jsonCreds, gcpCreds.BucketName, filename)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate signed URL: %v", err)
-	}
-
-	return url, nil
-}
-
-func generateSignedURL(jsonCreds []byte, bucketName, objectName string) (string, error) {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx, option.WithCredentialsJSON(jsonCreds))
-	if err != nil {
-		return "", fmt.Errorf("failed to create client: %v", err)
-	}
-	defer client.Close()
-
-	opts := &storage.SignedURLOptions{
-		Scheme:  storage.SigningSchemeV4,
-		Method:  "GET",
-		Expires: time.Now().Add(15 * time.Minute),
+	if err := store.Put(ctx, filename, f, contentType); err != nil {
+		return "", err
 	}
 
-	url, err := client.Bucket(bucketName).SignedURL(objectName, opts)
+	url, err := store.SignURL(ctx, filename, 15*time.Minute)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate signed URL: %v", err)
 	}
@@ -356,30 +322,15 @@ func ServeAudioFile(gcpCollection *mongo.Collection) http.HandlerFunc {
 			return
 		}
 
-		var creds models.GCPCredentials
-		err = gcpCollection.FindOne(context.TODO(), bson.M{"user_id": userID}).Decode(&creds)
-		if err != nil {
-			http.Error(w, "GCP credentials not found", http.StatusNotFound)
-			return
-		}
-
-		jsonCreds, err := base64.StdEncoding.DecodeString(creds.Credentials)
-		if err != nil {
-			http.Error(w, "Invalid GCP credentials", http.StatusInternalServerError)
-			return
-		}
-
 		ctx := context.Background()
-		client, err := storage.NewClient(ctx, option.WithCredentialsJSON(jsonCreds))
+		store, _, err := OpenUserBlobStore(ctx, gcpCollection, userID)
 		if err != nil {
-			http.Error(w, "Failed to create GCP storage client", http.StatusInternalServerError)
+			http.Error(w, "GCP credentials not found", http.StatusNotFound)
 			return
 		}
-		defer client.Close()
+		defer store.Close()
 
-		bucket := client.Bucket(creds.BucketName)
-		obj := bucket.Object(fmt.Sprintf("%s/%s", conversationID, fileName))
-		reader, err := obj.NewReader(ctx)
+		reader, err := store.Open(ctx, fmt.Sprintf("%s/%s", conversationID, fileName))
 		if err != nil {
 			http.Error(w, "Failed to read audio file", http.StatusInternalServerError)
 			return
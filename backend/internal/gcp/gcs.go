@@ -0,0 +1,96 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+type gcsStore struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+}
+
+func newGCSStore(ctx context.Context, jsonCreds []byte, bucketName string) (*gcsStore, error) {
+	client, err := storage.NewClient(ctx, option.WithCredentialsJSON(jsonCreds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCP storage client: %v", err)
+	}
+	return &gcsStore{client: client, bucket: client.Bucket(bucketName)}, nil
+}
+
+func (s *gcsStore) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	it := s.bucket.Objects(ctx, nil)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing bucket objects: %v", err)
+		}
+		objects = append(objects, ObjectInfo{
+			Name:        attrs.Name,
+			Size:        attrs.Size,
+			ContentType: attrs.ContentType,
+			Created:     attrs.Created,
+			Updated:     attrs.Updated,
+		})
+	}
+	return objects, nil
+}
+
+func (s *gcsStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	reader, err := s.bucket.Object(name).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %v", err)
+	}
+	return reader, nil
+}
+
+func (s *gcsStore) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	wc := s.bucket.Object(name).NewWriter(ctx)
+	wc.ContentType = contentType
+	if _, err := io.Copy(wc, r); err != nil {
+		wc.Close()
+		return fmt.Errorf("failed to copy file to GCP: %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to close GCP writer: %v", err)
+	}
+	return nil
+}
+
+func (s *gcsStore) Delete(ctx context.Context, name string) error {
+	err := s.bucket.Object(name).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+func (s *gcsStore) SignURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	url, err := s.bucket.SignedURL(name, &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  "GET",
+		Expires: time.Now().Add(expires),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signed URL: %v", err)
+	}
+	return url, nil
+}
+
+func (s *gcsStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,238 @@
+package gcp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// localStore keeps objects on the server's disk under
+// $LOCAL_STORAGE_ROOT/<user id>/<bucket name>.
+type localStore struct {
+	userID primitive.ObjectID
+	bucket string
+	root   string
+}
+
+func newLocalStore(userID primitive.ObjectID, bucketName string) (*localStore, error) {
+	if bucketName == "" {
+		bucketName = "default"
+	}
+	if strings.ContainsAny(bucketName, `/\`) || bucketName == "." || bucketName == ".." {
+		return nil, fmt.Errorf("invalid bucket name %q", bucketName)
+	}
+
+	root := filepath.Join(localStorageRoot(), userID.Hex(), bucketName)
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &localStore{userID: userID, bucket: bucketName, root: root}, nil
+}
+
+func localStorageRoot() string {
+	if root := os.Getenv("LOCAL_STORAGE_ROOT"); root != "" {
+		return root
+	}
+	return "storage"
+}
+
+// PublicBaseURL is the address clients and providers reach this server at.
+func PublicBaseURL() string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	return "http://localhost:8080"
+}
+
+// path maps an object name to a file below the store root, rejecting names
+// that would escape it.
+func (s *localStore) path(name string) (string, error) {
+	cleaned := filepath.Clean("/" + filepath.FromSlash(name))
+	if cleaned == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return filepath.Join(s.root, cleaned), nil
+}
+
+func (s *localStore) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".part") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{
+			Name:        filepath.ToSlash(rel),
+			Size:        info.Size(),
+			ContentType: mime.TypeByExtension(filepath.Ext(path)),
+			Created:     info.ModTime(),
+			Updated:     info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing local objects: %v", err)
+	}
+	return objects, nil
+}
+
+func (s *localStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object: %v", err)
+	}
+	return f, nil
+}
+
+func (s *localStore) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create object directory: %v", err)
+	}
+
+	// Write to a temporary file first so List never sees a partial object.
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create object: %v", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write object: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to close object: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *localStore) Delete(ctx context.Context, name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+// SignURL returns a link to ServeSignedBlob, authenticated by an HMAC over the
+// object location and expiry rather than a user session.
+func (s *localStore) SignURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	if _, err := s.path(name); err != nil {
+		return "", err
+	}
+	exp := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", exp)
+	query.Set("signature", signBlob(s.userID.Hex(), s.bucket, name, exp))
+
+	escaped := make([]string, 0)
+	for _, part := range strings.Split(name, "/") {
+		escaped = append(escaped, url.PathEscape(part))
+	}
+	return fmt.Sprintf("%s/blobs/%s/%s/%s?%s", PublicBaseURL(), s.userID.Hex(), url.PathEscape(s.bucket), strings.Join(escaped, "/"), query.Encode()), nil
+}
+
+func (s *localStore) Close() error {
+	return nil
+}
+
+func signBlob(userID, bucket, name, expires string) string {
+	mac := hmac.New(sha256.New, models.JWTSecret)
+	mac.Write([]byte(userID + "\n" + bucket + "\n" + name + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeSignedBlob streams an object from the local backend to holders of a
+// URL produced by SignURL, e.g. a transcription provider fetching the audio.
+func ServeSignedBlob(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		http.Error(w, "Link expired", http.StatusForbidden)
+		return
+	}
+	expected := signBlob(params["user"], params["bucket"], params["name"], expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(params["user"])
+	if err != nil {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+	store, err := newLocalStore(userID, params["bucket"])
+	if err != nil {
+		http.Error(w, "Invalid bucket", http.StatusBadRequest)
+		return
+	}
+
+	reader, err := store.Open(r.Context(), params["name"])
+	if err == ErrObjectNotFound {
+		http.Error(w, "Object not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening local object: %v", err)
+		http.Error(w, "Failed to read object", http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	if f, ok := reader.(*os.File); ok {
+		if info, err := f.Stat(); err == nil {
+			http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+			return
+		}
+	}
+	io.Copy(w, reader)
+}
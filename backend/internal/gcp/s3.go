@@ -0,0 +1,94 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// s3Store talks to AWS S3 or any S3-compatible server such as MinIO.
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func newS3Store(creds models.GCPCredentials) (*s3Store, error) {
+	endpoint := creds.S3Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(creds.S3AccessKey, creds.S3SecretKey, ""),
+		Secure: !creds.S3Insecure,
+		Region: creds.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %v", err)
+	}
+	return &s3Store{client: client, bucket: creds.BucketName}, nil
+}
+
+func (s *s3Store) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("error listing bucket objects: %v", obj.Err)
+		}
+		objects = append(objects, ObjectInfo{
+			Name:        obj.Key,
+			Size:        obj.Size,
+			ContentType: obj.ContentType,
+			Created:     obj.LastModified,
+			Updated:     obj.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+func (s *s3Store) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %v", err)
+	}
+	// GetObject is lazy; Stat surfaces a missing key before the caller
+	// starts writing a response.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to read object: %v", err)
+	}
+	return obj, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, name, r, -1, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to upload object to S3: %v", err)
+	}
+	return nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, name string) error {
+	return s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Store) SignURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	url, err := s.client.PresignedGetObject(ctx, s.bucket, name, expires, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signed URL: %v", err)
+	}
+	return url.String(), nil
+}
+
+func (s *s3Store) Close() error {
+	return nil
+}
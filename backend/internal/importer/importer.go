@@ -0,0 +1,147 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// maxImportSize bounds the whole request, all files included.
+const maxImportSize = 20 << 20
+
+// ImportProvider is the metadata provider of imported transcripts.
+const ImportProvider = "import"
+
+type importError struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// ImportConversations creates conversations from uploaded transcripts without
+// transcribing anything. Files are sent as multipart "file" fields; their
+// format is taken from ?format= (srt, vtt, json or omi) or detected from the
+// file. Files that fail to parse or save are reported and the rest still
+// imported.
+func ImportConversations(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			http.Error(w, "Invalid upload", http.StatusBadRequest)
+			return
+		}
+		files := r.MultipartForm.File["file"]
+		if len(files) == 0 {
+			http.Error(w, "No files uploaded", http.StatusBadRequest)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "", FormatSRT, FormatVTT, FormatJSON, FormatOmi:
+		default:
+			http.Error(w, "Unsupported format", http.StatusBadRequest)
+			return
+		}
+
+		imported := []models.Conversation{}
+		failed := []importError{}
+		for _, header := range files {
+			file, err := header.Open()
+			if err != nil {
+				failed = append(failed, importError{header.Filename, "could not read file"})
+				continue
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				failed = append(failed, importError{header.Filename, "could not read file"})
+				continue
+			}
+
+			fileFormat := format
+			if fileFormat == "" {
+				fileFormat = detectFormat(header.Filename, data)
+			}
+			if fileFormat == "" {
+				failed = append(failed, importError{header.Filename, "unrecognised format"})
+				continue
+			}
+			conversations, err := parse(fileFormat, header.Filename, data)
+			if err != nil {
+				failed = append(failed, importError{header.Filename, err.Error()})
+				continue
+			}
+
+			for _, p := range conversations {
+				conversation := newConversation(userID, p)
+				result, err := collection.InsertOne(context.TODO(), conversation)
+				if err != nil {
+					// Conversations already created stay imported, so the
+					// failure is reported with them rather than as a 500.
+					log.Printf("Error creating imported conversation from %s: %v", header.Filename, err)
+					failed = append(failed, importError{header.Filename, "could not save conversation " + conversation.Name})
+					continue
+				}
+				conversation.ID = result.InsertedID.(primitive.ObjectID)
+				imported = append(imported, conversation)
+			}
+		}
+
+		status := http.StatusCreated
+		if len(imported) == 0 {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"imported": imported, "errors": failed})
+	}
+}
+
+func newConversation(userID primitive.ObjectID, p parsed) models.Conversation {
+	now := time.Now()
+	createdAt := p.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	duration := 0.0
+	for _, sentence := range p.Transcript {
+		if sentence.End > duration {
+			duration = sentence.End
+		}
+	}
+	if p.ActionItems == nil {
+		p.ActionItems = []string{}
+	}
+	return models.Conversation{
+		UserID:      userID,
+		Name:        p.Name,
+		Transcript:  p.Transcript,
+		ChatHistory: []models.ChatMessage{},
+		Summary:     p.Summary,
+		ActionItems: p.ActionItems,
+		Analysis:    p.Analysis,
+		Metadata: &models.TranscriptionMetadata{
+			Provider:      ImportProvider,
+			AudioDuration: duration,
+			Languages:     p.Languages,
+			TranscribedAt: now,
+		},
+		CreatedAt:       createdAt,
+		UpdatedAt:       now,
+		NeedsActionSync: true,
+	}
+}
@@ -0,0 +1,344 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/prompts"
+)
+
+const (
+	FormatSRT  = "srt"
+	FormatVTT  = "vtt"
+	FormatJSON = "json"
+	FormatOmi  = "omi"
+)
+
+// parsed is one conversation read from an import file.
+type parsed struct {
+	Name        string
+	CreatedAt   time.Time
+	Transcript  []models.TranscriptionSentence
+	Summary     string
+	ActionItems []string
+	Analysis    map[string]string
+	Languages   []string
+}
+
+// detectFormat picks the format from the file name, falling back to the
+// content. JSON files are told apart by the Omi app's transcript_segments.
+func detectFormat(fileName string, data []byte) string {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".srt":
+		return FormatSRT
+	case ".vtt":
+		return FormatVTT
+	}
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("WEBVTT")):
+		return FormatVTT
+	case bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")):
+		if bytes.Contains(trimmed, []byte(`"transcript_segments"`)) {
+			return FormatOmi
+		}
+		return FormatJSON
+	case srtTiming.Match(trimmed):
+		return FormatSRT
+	}
+	return ""
+}
+
+func parse(format, fileName string, data []byte) ([]parsed, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	name := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	switch format {
+	case FormatSRT, FormatVTT:
+		transcript, err := parseCaptions(data)
+		if err != nil {
+			return nil, err
+		}
+		return []parsed{{Name: name, Transcript: transcript}}, nil
+	case FormatJSON:
+		return parseExportJSON(data, name)
+	case FormatOmi:
+		return parseOmi(data)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+var (
+	srtTiming   = regexp.MustCompile(`(?m)^\s*(?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3}\s*-->`)
+	cueTiming   = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})`)
+	voiceTag    = regexp.MustCompile(`^<v(?:\.[^ >]*)?\s+([^>]+)>`)
+	markupTag   = regexp.MustCompile(`</?[^>]+>`)
+	speakerName = regexp.MustCompile(`^([^:]{1,40}):\s+(.+)$`)
+	unnamed     = regexp.MustCompile(`^Speaker\s+(\S+)$`)
+)
+
+// parseCaptions reads SRT and WebVTT cues. A speaker is taken from a WebVTT
+// voice tag or a "Name: " prefix, as written by our own exports; "Speaker N"
+// becomes the label N.
+func parseCaptions(data []byte) ([]models.TranscriptionSentence, error) {
+	transcript := []models.TranscriptionSentence{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var current *models.TranscriptionSentence
+	var lines []string
+	flush := func() {
+		if current != nil && len(lines) > 0 {
+			text := strings.Join(lines, " ")
+			speaker := ""
+			if m := voiceTag.FindStringSubmatch(text); m != nil {
+				speaker, text = strings.TrimSpace(m[1]), text[len(m[0]):]
+			}
+			text = strings.TrimSpace(markupTag.ReplaceAllString(text, ""))
+			if m := speakerName.FindStringSubmatch(text); speaker == "" && m != nil {
+				speaker, text = strings.TrimSpace(m[1]), m[2]
+			}
+			if m := unnamed.FindStringSubmatch(speaker); m != nil {
+				speaker = m[1]
+			}
+			if speaker == "" {
+				speaker = "0"
+			}
+			if text != "" {
+				current.Sentence = unescapeCaption(text)
+				current.Speaker = speaker
+				current.Confidence = 1
+				current.Words = []models.TranscriptionWord{}
+				transcript = append(transcript, *current)
+			}
+		}
+		current, lines = nil, nil
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := cueTiming.FindStringSubmatch(line); m != nil {
+			flush()
+			start, err := parseTimestamp(m[1])
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseTimestamp(m[2])
+			if err != nil {
+				return nil, err
+			}
+			current = &models.TranscriptionSentence{Start: start, End: end}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if current != nil {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading captions: %v", err)
+	}
+	flush()
+
+	if len(transcript) == 0 {
+		return nil, fmt.Errorf("no caption cues found")
+	}
+	return transcript, nil
+}
+
+// parseTimestamp reads [HH:]MM:SS,mmm or [HH:]MM:SS.mmm as seconds.
+func parseTimestamp(value string) (float64, error) {
+	value = strings.Replace(value, ",", ".", 1)
+	parts := strings.Split(value, ":")
+	seconds := 0.0
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
+
+func unescapeCaption(text string) string {
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+}
+
+// exportedConversation is the document written by the json export format.
+type exportedConversation struct {
+	Name        string                         `json:"name"`
+	CreatedAt   time.Time                      `json:"created_at"`
+	Summary     string                         `json:"summary"`
+	ActionItems []string                       `json:"action_items"`
+	Analysis    map[string]string              `json:"analysis"`
+	Metadata    *models.TranscriptionMetadata  `json:"metadata"`
+	Transcript  []models.TranscriptionSentence `json:"transcript"`
+}
+
+// parseExportJSON reads one conversation, or an array of them, in our own
+// JSON export format. Speaker assignments refer to the exporting account's
+// people, so only the labels are kept.
+func parseExportJSON(data []byte, name string) ([]parsed, error) {
+	var documents []exportedConversation
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &documents); err != nil {
+			return nil, fmt.Errorf("invalid JSON export: %v", err)
+		}
+	} else {
+		var document exportedConversation
+		if err := json.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("invalid JSON export: %v", err)
+		}
+		documents = append(documents, document)
+	}
+
+	var result []parsed
+	for _, document := range documents {
+		if len(document.Transcript) == 0 {
+			return nil, fmt.Errorf("JSON export has no transcript")
+		}
+		conversation := parsed{
+			Name:        document.Name,
+			CreatedAt:   document.CreatedAt,
+			Transcript:  document.Transcript,
+			Summary:     document.Summary,
+			ActionItems: document.ActionItems,
+			Analysis:    analysis(document.Analysis),
+		}
+		if conversation.Name == "" {
+			conversation.Name = name
+		}
+		if document.Metadata != nil {
+			conversation.Languages = document.Metadata.Languages
+		}
+		result = append(result, conversation)
+	}
+	return result, nil
+}
+
+// analysis keeps the answers whose prompt names can be stored as field
+// names, dropping the rest of an edited or foreign export.
+func analysis(answers map[string]string) map[string]string {
+	var kept map[string]string
+	for name, answer := range answers {
+		if !prompts.ValidName(name) {
+			continue
+		}
+		if kept == nil {
+			kept = map[string]string{}
+		}
+		kept[name] = answer
+	}
+	return kept
+}
+
+// omiMemory is a memory as exported by the Omi app.
+type omiMemory struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	Language   string     `json:"language"`
+	Structured struct {
+		Title       string `json:"title"`
+		Overview    string `json:"overview"`
+		ActionItems []struct {
+			Description string `json:"description"`
+		} `json:"action_items"`
+	} `json:"structured"`
+	TranscriptSegments []struct {
+		Text      string  `json:"text"`
+		Speaker   string  `json:"speaker"`
+		SpeakerID *int    `json:"speaker_id"`
+		IsUser    bool    `json:"is_user"`
+		Start     float64 `json:"start"`
+		End       float64 `json:"end"`
+	} `json:"transcript_segments"`
+	Discarded bool `json:"discarded"`
+}
+
+// parseOmi reads an Omi app memory export: a single memory, an array of
+// them, or an object with a "memories" array. Discarded memories and memories
+// without a transcript are skipped.
+func parseOmi(data []byte) ([]parsed, error) {
+	var memories []omiMemory
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &memories); err != nil {
+			return nil, fmt.Errorf("invalid Omi export: %v", err)
+		}
+	default:
+		var wrapper struct {
+			Memories []omiMemory `json:"memories"`
+		}
+		if err := json.Unmarshal(trimmed, &wrapper); err == nil && len(wrapper.Memories) > 0 {
+			memories = wrapper.Memories
+			break
+		}
+		var memory omiMemory
+		if err := json.Unmarshal(trimmed, &memory); err != nil {
+			return nil, fmt.Errorf("invalid Omi export: %v", err)
+		}
+		memories = append(memories, memory)
+	}
+
+	var result []parsed
+	for _, memory := range memories {
+		if memory.Discarded || len(memory.TranscriptSegments) == 0 {
+			continue
+		}
+		conversation := parsed{
+			Name:        memory.Structured.Title,
+			CreatedAt:   memory.CreatedAt,
+			Summary:     memory.Structured.Overview,
+			ActionItems: []string{},
+			Transcript:  []models.TranscriptionSentence{},
+		}
+		if memory.StartedAt != nil {
+			conversation.CreatedAt = *memory.StartedAt
+		}
+		if memory.Language != "" {
+			conversation.Languages = []string{memory.Language}
+		}
+		for _, item := range memory.Structured.ActionItems {
+			if item.Description != "" {
+				conversation.ActionItems = append(conversation.ActionItems, item.Description)
+			}
+		}
+		for _, segment := range memory.TranscriptSegments {
+			speaker := strings.TrimPrefix(segment.Speaker, "SPEAKER_")
+			if n, err := strconv.Atoi(speaker); err == nil {
+				speaker = strconv.Itoa(n)
+			}
+			if segment.SpeakerID != nil {
+				speaker = strconv.Itoa(*segment.SpeakerID)
+			}
+			if speaker == "" {
+				speaker = "0"
+			}
+			conversation.Transcript = append(conversation.Transcript, models.TranscriptionSentence{
+				Sentence:   strings.TrimSpace(segment.Text),
+				Start:      segment.Start,
+				End:        segment.End,
+				Words:      []models.TranscriptionWord{},
+				Confidence: 1,
+				Speaker:    speaker,
+			})
+		}
+		result = append(result, conversation)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no memories with a transcript in Omi export")
+	}
+	return result, nil
+}
@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// describe renders sentences as "speaker:text[start-end]".
+func describe(sentences []models.TranscriptionSentence) string {
+	parts := make([]string, len(sentences))
+	for i, s := range sentences {
+		parts[i] = fmt.Sprintf("%s:%s[%g-%g]", s.Speaker, s.Sentence, s.Start, s.End)
+	}
+	return strings.Join(parts, " | ")
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"00:00:01,500", 1.5},
+		{"00:01:02.250", 62.25},
+		{"01:00:00,000", 3600},
+		{"12:34.5", 754.5},
+		{"100:00:00.000", 360000},
+	}
+	for _, test := range tests {
+		got, err := parseTimestamp(test.value)
+		if err != nil || got != test.want {
+			t.Errorf("parseTimestamp(%q) = %g, %v, want %g", test.value, got, err, test.want)
+		}
+	}
+	for _, value := range []string{"", "00:xx:01,000", "1,2,3"} {
+		if got, err := parseTimestamp(value); err == nil {
+			t.Errorf("parseTimestamp(%q) = %g, want an error", value, got)
+		}
+	}
+}
+
+func TestParseCaptions(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"srt", "1\r\n00:00:00,000 --> 00:00:01,500\r\nHello there.\r\n\r\n2\r\n00:00:01,500 --> 00:00:03,000\r\nGeneral Kenobi.\r\n",
+			"0:Hello there.[0-1.5] | 0:General Kenobi.[1.5-3]"},
+		{"srt with a speaker prefix over two lines", "1\n00:00:00,000 --> 00:00:02,000\nAlice: we should\nship it\n",
+			"Alice:we should ship it[0-2]"},
+		{"srt numbered speakers", "1\n00:00:00,000 --> 00:00:02,000\nSpeaker 1: hi\n",
+			"1:hi[0-2]"},
+		{"vtt voice tags", "WEBVTT\n\n00:00.000 --> 00:02.000\n<v Bob>Morning</v>\n\n00:02.000 --> 00:04.000 align:start\n<v.loud Speaker 2>Hi <i>Bob</i></v>\n",
+			"Bob:Morning[0-2] | 2:Hi Bob[2-4]"},
+		{"vtt header, notes and cue ids", "WEBVTT - export\n\nNOTE generated\n\nintro\n00:00:01.000 --> 00:00:02.000\nfish &amp; chips &lt;3\n",
+			"0:fish & chips <3[1-2]"},
+		{"empty cues are skipped", "1\n00:00:00,000 --> 00:00:01,000\n<b></b>\n\n2\n00:00:01,000 --> 00:00:02,000\nok\n",
+			"0:ok[1-2]"},
+		{"a url is not a speaker", "1\n00:00:00,000 --> 00:00:01,000\nsee https://example.com\n",
+			"0:see https://example.com[0-1]"},
+	}
+	for _, test := range tests {
+		got, err := parseCaptions([]byte(test.data))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if describe(got) != test.want {
+			t.Errorf("%s:\n got %s\nwant %s", test.name, describe(got), test.want)
+		}
+	}
+
+	for _, data := range []string{"", "WEBVTT\n\n", "just some text\n"} {
+		if got, err := parseCaptions([]byte(data)); err == nil {
+			t.Errorf("parseCaptions(%q) = %s, want an error", data, describe(got))
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		fileName string
+		data     string
+		want     string
+	}{
+		{"talk.srt", "anything", FormatSRT},
+		{"talk.VTT", "anything", FormatVTT},
+		{"talk.txt", "\xef\xbb\xbfWEBVTT\n", FormatVTT},
+		{"talk.txt", "1\n00:00:00,000 --> 00:00:01,000\nhi\n", FormatSRT},
+		{"talk.json", `{"name": "x", "transcript": []}`, FormatJSON},
+		{"memories.json", ` [{"transcript_segments": []}]`, FormatOmi},
+		{"notes.txt", "hello", ""},
+	}
+	for _, test := range tests {
+		if got := detectFormat(test.fileName, []byte(test.data)); got != test.want {
+			t.Errorf("detectFormat(%q, %q) = %q, want %q", test.fileName, test.data, got, test.want)
+		}
+	}
+}
+
+func TestParseExportJSON(t *testing.T) {
+	data := `{
+		"name": "Standup",
+		"summary": "Short",
+		"analysis": {"Decisions": "ship", "a.b": "dotted", "$where": "operator", "": "empty"},
+		"metadata": {"languages": ["en"]},
+		"transcript": [{"sentence": "hi", "start": 0, "end": 1, "speaker": "0"}]
+	}`
+	got, err := parseExportJSON([]byte(data), "file")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "Standup" || describe(got[0].Transcript) != "0:hi[0-1]" || len(got[0].Languages) != 1 {
+		t.Fatalf("parseExportJSON = %+v", got)
+	}
+	if len(got[0].Analysis) != 2 || got[0].Analysis["Decisions"] != "ship" || got[0].Analysis[""] != "empty" {
+		t.Errorf("analysis = %v, want only the keys Mongo can store", got[0].Analysis)
+	}
+
+	got, err = parseExportJSON([]byte(`[{"transcript": [{"sentence": "a"}]}, {"transcript": [{"sentence": "b"}]}]`), "file")
+	if err != nil || len(got) != 2 || got[0].Name != "file" || got[0].Analysis != nil {
+		t.Errorf("parseExportJSON of an array = %+v, %v", got, err)
+	}
+	if _, err := parseExportJSON([]byte(`{"name": "empty"}`), "file"); err == nil {
+		t.Errorf("parseExportJSON without a transcript succeeded")
+	}
+}
+
+func TestParseOmi(t *testing.T) {
+	data := `{"memories": [
+		{
+			"created_at": "2026-10-16T10:00:00Z",
+			"started_at": "2026-10-16T09:30:00Z",
+			"language": "en",
+			"structured": {"title": "Planning", "overview": "Plans", "action_items": [{"description": "Book room"}, {"description": ""}]},
+			"transcript_segments": [
+				{"text": " hi ", "speaker": "SPEAKER_01", "start": 0, "end": 1},
+				{"text": "hey", "speaker": "SPEAKER_00", "speaker_id": 3, "start": 1, "end": 2},
+				{"text": "yo", "start": 2, "end": 3}
+			]
+		},
+		{"discarded": true, "transcript_segments": [{"text": "skip"}]},
+		{"structured": {"title": "Empty"}}
+	]}`
+	got, err := parseOmi([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("parseOmi returned %d conversations, want 1", len(got))
+	}
+	memory := got[0]
+	if memory.Name != "Planning" || memory.Summary != "Plans" || memory.CreatedAt.Hour() != 9 || len(memory.ActionItems) != 1 {
+		t.Errorf("parseOmi = %+v", memory)
+	}
+	if want := "1:hi[0-1] | 3:hey[1-2] | 0:yo[2-3]"; describe(memory.Transcript) != want {
+		t.Errorf("transcript:\n got %s\nwant %s", describe(memory.Transcript), want)
+	}
+
+	if _, err := parseOmi([]byte(`[{"discarded": true, "transcript_segments": [{"text": "x"}]}]`)); err == nil {
+		t.Errorf("parseOmi with only discarded memories succeeded")
+	}
+}
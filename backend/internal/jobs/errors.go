@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+)
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that the job fails immediately instead of being
+// retried.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// retryAfterError carries the minimum delay a provider asked for.
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// RetryAfter wraps err so that the next attempt is not scheduled sooner than
+// delay, even if the usual backoff is shorter.
+func RetryAfter(err error, delay time.Duration) error {
+	return &retryAfterError{err: err, delay: delay}
+}
+
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+func retryDelay(err error, attempts int) time.Duration {
+	delay := backoff(attempts)
+	var retryAfter *retryAfterError
+	if errors.As(err, &retryAfter) && retryAfter.delay > delay {
+		delay = retryAfter.delay
+	}
+	return delay
+}
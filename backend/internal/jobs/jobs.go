@@ -0,0 +1,365 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	awaitingCallbackOwner = "callback"
+)
+
+// QuotaChecker decides whether a user's transcriptions must be held, and
+// if so until when.
+type QuotaChecker interface {
+	CheckQuota(ctx context.Context, userID primitive.ObjectID) (holdUntil time.Time, exceeded bool, err error)
+}
+
+// Queue stores transcription jobs in Mongo. At most one job per conversation
+// is active (queued, held or running) at a time; the job's state is mirrored
+// onto the conversation's transcription_status.
+type Queue struct {
+	jobs          *mongo.Collection
+	conversations *mongo.Collection
+	quota         QuotaChecker
+}
+
+// NewQueue creates a queue. quota may be nil, in which case jobs are never held.
+func NewQueue(jobsCollection, conversationsCollection *mongo.Collection, quota QuotaChecker) *Queue {
+	return &Queue{jobs: jobsCollection, conversations: conversationsCollection, quota: quota}
+}
+
+// EnsureIndexes creates the index that makes Enqueue idempotent per
+// conversation and the index used by Lease.
+func (q *Queue) EnsureIndexes(ctx context.Context) error {
+	_, err := q.jobs.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "conversation_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"active": true}),
+		},
+		{
+			Keys: bson.D{{Key: "active", Value: 1}, {Key: "state", Value: 1}, {Key: "next_run_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "conversation_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+// Enqueue queues a transcription for the conversation, or returns the job
+// already active for it. Users over their quota get a held job instead.
+func (q *Queue) Enqueue(ctx context.Context, userID, conversationID primitive.ObjectID) (*models.TranscriptionJob, error) {
+	return q.EnqueueWithOptions(ctx, userID, conversationID, nil)
+}
+
+// EnqueueWithOptions is Enqueue with provider options for the new job. An
+// already active job keeps the options it was created with.
+func (q *Queue) EnqueueWithOptions(ctx context.Context, userID, conversationID primitive.ObjectID, transcriptionOptions *models.TranscriptionOptions) (*models.TranscriptionJob, error) {
+	now := time.Now()
+	state, nextRunAt := models.JobQueued, now
+	holdUntil, exceeded, err := q.checkQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if exceeded {
+		state, nextRunAt = models.JobHeld, holdUntil
+	}
+
+	filter := bson.M{"conversation_id": conversationID, "active": true}
+	update := bson.M{"$setOnInsert": models.TranscriptionJob{
+		UserID:         userID,
+		ConversationID: conversationID,
+		State:          state,
+		Active:         true,
+		MaxAttempts:    defaultMaxAttempts,
+		Options:        transcriptionOptions,
+		NextRunAt:      nextRunAt,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var job models.TranscriptionJob
+	err = q.jobs.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if mongo.IsDuplicateKeyError(err) {
+		// Lost an upsert race with another request; the winner's job is the one to report.
+		err = q.jobs.FindOne(ctx, filter).Decode(&job)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error enqueuing transcription job: %v", err)
+	}
+
+	if job.State == models.JobQueued || job.State == models.JobHeld {
+		q.setConversationStatus(ctx, conversationID, job.State)
+	}
+	return &job, nil
+}
+
+// Lease claims the next due job for owner, including held jobs whose hold
+// ran out and running jobs whose previous lease expired because their worker
+// died. It returns nil when no job is due.
+func (q *Queue) Lease(ctx context.Context, owner string, lease time.Duration) (*models.TranscriptionJob, error) {
+	now := time.Now()
+	filter := bson.M{
+		"active": true,
+		"$or": []bson.M{
+			{"state": bson.M{"$in": []string{models.JobQueued, models.JobHeld}}, "next_run_at": bson.M{"$lte": now}},
+			{"state": models.JobRunning, "lease_expires_at": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"state":            models.JobRunning,
+			"lease_owner":      owner,
+			"lease_expires_at": now.Add(lease),
+			"updated_at":       now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job models.TranscriptionJob
+	err := q.jobs.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leasing transcription job: %v", err)
+	}
+
+	q.setConversationStatus(ctx, job.ConversationID, models.JobRunning)
+	return &job, nil
+}
+
+// Get returns a job by ID.
+func (q *Queue) Get(ctx context.Context, id primitive.ObjectID) (*models.TranscriptionJob, error) {
+	var job models.TranscriptionJob
+	if err := q.jobs.FindOne(ctx, bson.M{"_id": id}).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// SetProviderJob records the provider's ID for a transcription submitted on
+// behalf of a leased job, along with the options it was submitted with.
+func (q *Queue) SetProviderJob(ctx context.Context, job *models.TranscriptionJob, providerJobID string, opts models.TranscriptionOptions) error {
+	now := time.Now()
+	_, err := q.jobs.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "lease_owner": job.LeaseOwner},
+		bson.M{"$set": bson.M{"provider_job_id": providerJobID, "options": opts, "submitted_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("error saving provider job ID: %v", err)
+	}
+	job.ProviderJobID = providerJobID
+	job.Options = &opts
+	job.SubmittedAt = &now
+	return nil
+}
+
+// Await parks a leased job that is waiting for a provider callback. The job
+// stays running, but its lease is handed back so that a worker picks it up
+// again after wait if the callback never arrives. Waiting does not count as
+// an attempt.
+func (q *Queue) Await(ctx context.Context, job *models.TranscriptionJob, wait time.Duration) error {
+	now := time.Now()
+	_, err := q.jobs.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "lease_owner": job.LeaseOwner, "state": models.JobRunning},
+		bson.M{
+			"$set": bson.M{"lease_owner": awaitingCallbackOwner, "lease_expires_at": now.Add(wait), "updated_at": now},
+			"$inc": bson.M{"attempts": -1},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error parking transcription job: %v", err)
+	}
+	return nil
+}
+
+// Hold puts a leased job back without using an attempt, to be leased again
+// at until.
+func (q *Queue) Hold(ctx context.Context, job *models.TranscriptionJob, until time.Time) error {
+	_, err := q.jobs.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "lease_owner": job.LeaseOwner},
+		bson.M{
+			"$set":   bson.M{"state": models.JobHeld, "next_run_at": until, "updated_at": time.Now()},
+			"$unset": bson.M{"lease_owner": "", "lease_expires_at": ""},
+			"$inc":   bson.M{"attempts": -1},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error holding transcription job: %v", err)
+	}
+	q.setConversationStatus(ctx, job.ConversationID, models.JobHeld)
+	return nil
+}
+
+// ReleaseHeld makes all of a user's held jobs due now, e.g. after their quota
+// was raised. Jobs still over quota are held again when leased.
+func (q *Queue) ReleaseHeld(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := q.jobs.UpdateMany(ctx,
+		bson.M{"user_id": userID, "state": models.JobHeld},
+		bson.M{"$set": bson.M{"next_run_at": time.Now(), "updated_at": time.Now()}},
+	)
+	return err
+}
+
+func (q *Queue) checkQuota(ctx context.Context, userID primitive.ObjectID) (time.Time, bool, error) {
+	if q.quota == nil {
+		return time.Time{}, false, nil
+	}
+	holdUntil, exceeded, err := q.quota.CheckQuota(ctx, userID)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("error checking quota: %v", err)
+	}
+	return holdUntil, exceeded, nil
+}
+
+// Wake ends the wait of a parked job so that the next Lease picks it up.
+func (q *Queue) Wake(ctx context.Context, job *models.TranscriptionJob) error {
+	_, err := q.jobs.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "lease_owner": awaitingCallbackOwner, "state": models.JobRunning},
+		bson.M{"$set": bson.M{"lease_expires_at": time.Now(), "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// CompleteCallback marks a job as succeeded from a provider callback, whoever
+// currently holds its lease.
+func (q *Queue) CompleteCallback(ctx context.Context, job *models.TranscriptionJob) error {
+	now := time.Now()
+	_, err := q.jobs.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "active": true},
+		bson.M{
+			"$set":   bson.M{"state": models.JobSucceeded, "updated_at": now, "finished_at": now},
+			"$unset": bson.M{"active": "", "lease_owner": "", "lease_expires_at": "", "last_error": ""},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error completing transcription job: %v", err)
+	}
+	q.setConversationStatus(ctx, job.ConversationID, models.JobSucceeded)
+	return nil
+}
+
+// Complete marks a leased job as succeeded.
+func (q *Queue) Complete(ctx context.Context, job *models.TranscriptionJob) error {
+	now := time.Now()
+	_, err := q.jobs.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "lease_owner": job.LeaseOwner},
+		bson.M{
+			"$set":   bson.M{"state": models.JobSucceeded, "updated_at": now, "finished_at": now},
+			"$unset": bson.M{"active": "", "lease_owner": "", "lease_expires_at": "", "last_error": ""},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error completing transcription job: %v", err)
+	}
+	q.setConversationStatus(ctx, job.ConversationID, models.JobSucceeded)
+	return nil
+}
+
+// Fail records a failed attempt. The job is requeued with exponential backoff
+// (or the delay requested through RetryAfter) until it runs out of attempts or
+// the error is Permanent, after which it is marked failed.
+func (q *Queue) Fail(ctx context.Context, job *models.TranscriptionJob, cause error) error {
+	now := time.Now()
+	var update bson.M
+	state := models.JobQueued
+	if job.Attempts >= job.MaxAttempts || isPermanent(cause) {
+		state = models.JobFailed
+		update = bson.M{
+			"$set":   bson.M{"state": state, "last_error": cause.Error(), "updated_at": now, "finished_at": now},
+			"$unset": bson.M{"active": "", "lease_owner": "", "lease_expires_at": ""},
+		}
+	} else {
+		update = bson.M{
+			"$set":   bson.M{"state": state, "last_error": cause.Error(), "next_run_at": now.Add(retryDelay(cause, job.Attempts)), "updated_at": now},
+			"$unset": bson.M{"lease_owner": "", "lease_expires_at": "", "provider_job_id": "", "submitted_at": ""},
+		}
+	}
+
+	_, err := q.jobs.UpdateOne(ctx, bson.M{"_id": job.ID, "lease_owner": job.LeaseOwner}, update)
+	if err != nil {
+		return fmt.Errorf("error failing transcription job: %v", err)
+	}
+	q.setConversationStatus(ctx, job.ConversationID, state)
+	return nil
+}
+
+// Latest returns the most recent job for a conversation, or nil if it has
+// never been queued.
+func (q *Queue) Latest(ctx context.Context, userID, conversationID primitive.ObjectID) (*models.TranscriptionJob, error) {
+	var job models.TranscriptionJob
+	err := q.jobs.FindOne(ctx,
+		bson.M{"user_id": userID, "conversation_id": conversationID},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (q *Queue) setConversationStatus(ctx context.Context, conversationID primitive.ObjectID, state string) {
+	_, _ = q.conversations.UpdateOne(ctx,
+		bson.M{"_id": conversationID},
+		bson.M{"$set": bson.M{"transcription_status": state}},
+	)
+}
+
+// backoff doubles from 30 seconds per attempt, capped at 30 minutes.
+func backoff(attempts int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempts && d < 30*time.Minute; i++ {
+		d *= 2
+	}
+	if d > 30*time.Minute {
+		d = 30 * time.Minute
+	}
+	return d
+}
+
+func GetTranscriptionStatus(queue *Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		job, err := queue.Latest(context.TODO(), userID, conversationID)
+		if err != nil {
+			http.Error(w, "Error fetching transcription status", http.StatusInternalServerError)
+			return
+		}
+		if job == nil {
+			http.Error(w, "No transcription job found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(job)
+	}
+}
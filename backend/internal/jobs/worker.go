@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// ErrAwaitCallback is returned by a ProcessFunc that handed the job to a
+// provider which will report back through a webhook.
+var ErrAwaitCallback = errors.New("awaiting provider callback")
+
+// ProcessFunc runs a single leased job. A nil error completes the job,
+// ErrAwaitCallback parks it and any other error schedules a retry.
+type ProcessFunc func(ctx context.Context, job *models.TranscriptionJob) error
+
+type Worker struct {
+	queue         *Queue
+	process       ProcessFunc
+	owner         string
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	// CallbackWait is how long a parked job waits for its callback before a
+	// worker checks on it directly.
+	CallbackWait time.Duration
+}
+
+func NewWorker(queue *Queue, process ProcessFunc) *Worker {
+	hostname, _ := os.Hostname()
+	return &Worker{
+		queue:         queue,
+		process:       process,
+		owner:         fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), primitive.NewObjectID().Hex()),
+		PollInterval:  5 * time.Second,
+		LeaseDuration: 30 * time.Minute,
+		CallbackWait:  10 * time.Minute,
+	}
+}
+
+// Run leases and processes jobs until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		job, err := w.queue.Lease(ctx, w.owner, w.LeaseDuration)
+		if err != nil {
+			log.Printf("Error leasing transcription job: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.PollInterval):
+			}
+			continue
+		}
+
+		w.runJob(ctx, job)
+	}
+}
+
+func (w *Worker) runJob(ctx context.Context, job *models.TranscriptionJob) {
+	// Parked jobs already sent their audio to the provider, so only new
+	// submissions are held back by the quota.
+	if job.ProviderJobID == "" {
+		holdUntil, exceeded, err := w.queue.checkQuota(ctx, job.UserID)
+		if err != nil {
+			log.Printf("Error checking quota for transcription job %s: %v", job.ID.Hex(), err)
+		}
+		if exceeded {
+			if err := w.queue.Hold(ctx, job, holdUntil); err != nil {
+				log.Printf("Error holding transcription job %s: %v", job.ID.Hex(), err)
+			}
+			return
+		}
+	}
+
+	// Stop before the lease runs out so another worker never picks up a job
+	// that is still being processed here.
+	jobCtx, cancel := context.WithTimeout(ctx, w.LeaseDuration-time.Minute)
+	defer cancel()
+
+	err := w.process(jobCtx, job)
+	if err == nil {
+		if err := w.queue.Complete(ctx, job); err != nil {
+			log.Printf("Error completing transcription job %s: %v", job.ID.Hex(), err)
+		}
+		return
+	}
+	if errors.Is(err, ErrAwaitCallback) {
+		if err := w.queue.Await(ctx, job, w.CallbackWait); err != nil {
+			log.Printf("Error parking transcription job %s: %v", job.ID.Hex(), err)
+		}
+		return
+	}
+
+	log.Printf("Transcription job %s failed (attempt %d/%d): %v", job.ID.Hex(), job.Attempts, job.MaxAttempts, err)
+	if err := w.queue.Fail(ctx, job, err); err != nil {
+		log.Printf("Error recording transcription job failure %s: %v", job.ID.Hex(), err)
+	}
+}
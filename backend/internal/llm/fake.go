@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// fakeProvider answers without any network access, for development. It
+// replies with the line of the system prompt that shares the most words with
+// the last user message, so answers still come from the supplied context.
+type fakeProvider struct{}
+
+func (fakeProvider) Name() string {
+	return ProviderFake
+}
+
+func (fakeProvider) Complete(ctx context.Context, messages []Message) (string, error) {
+	var question string
+	var lines []string
+	for _, message := range messages {
+		switch message.Role {
+		case RoleSystem:
+			lines = append(lines, strings.Split(message.Content, "\n")...)
+		case RoleUser:
+			question = message.Content
+		}
+	}
+
+	asked := map[string]bool{}
+	for _, word := range keywords(question) {
+		asked[word] = true
+	}
+	best, bestScore := "", 0
+	for _, line := range lines {
+		score := 0
+		for _, word := range keywords(line) {
+			if asked[word] {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = strings.TrimSpace(line), score
+		}
+	}
+
+	if best == "" {
+		return fmt.Sprintf("I couldn't find anything about %q.", strings.TrimSpace(question)), nil
+	}
+	return fmt.Sprintf("The closest match I found is: %s", best), nil
+}
+
+// keywords returns the lowercased words of text longer than three letters,
+// which leaves out most function words.
+func keywords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) > 3 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// Stream sends the reply a word at a time.
+func (f fakeProvider) Stream(ctx context.Context, messages []Message, onDelta func(string) error) (string, error) {
+	reply, err := f.Complete(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	for i, word := range strings.Fields(reply) {
+		if i > 0 {
+			word = " " + word
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if err := onDelta(word); err != nil {
+			return "", err
+		}
+	}
+	return reply, nil
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	ProviderOpenAI = "openai"
+	ProviderFake   = "fake"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ErrUnauthorized is returned when a provider rejects the API key.
+var ErrUnauthorized = errors.New("LLM provider rejected the API key")
+
+// Message is one turn of a chat completion request.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Provider generates the next assistant message of a chat.
+type Provider interface {
+	Name() string
+	Complete(ctx context.Context, messages []Message) (string, error)
+}
+
+// StreamingProvider is implemented by providers that can return a reply a
+// piece at a time as it is generated. onDelta is called with each piece; an
+// error from it stops the stream.
+type StreamingProvider interface {
+	Provider
+	Stream(ctx context.Context, messages []Message, onDelta func(string) error) (string, error)
+}
+
+// Stream generates a reply through onDelta, in pieces if the provider can
+// stream and otherwise all at once. It returns the whole reply.
+func Stream(ctx context.Context, provider Provider, messages []Message, onDelta func(string) error) (string, error) {
+	if streaming, ok := provider.(StreamingProvider); ok {
+		return streaming.Stream(ctx, messages, onDelta)
+	}
+	reply, err := provider.Complete(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	if err := onDelta(reply); err != nil {
+		return "", err
+	}
+	return reply, nil
+}
+
+// NewProvider returns the LLM provider selected in the user's stored
+// credentials. The fake provider is the default, as it needs no key or
+// network access.
+func NewProvider(creds models.GCPCredentials) (Provider, error) {
+	switch creds.LLMProvider {
+	case "", ProviderFake:
+		return fakeProvider{}, nil
+	case ProviderOpenAI:
+		return newOpenAIProvider(creds.LLMURL, creds.LLMKey, creds.LLMModel), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", creds.LLMProvider)
+	}
+}
+
+// UserProvider returns the LLM provider configured in the user's stored
+// credentials, or the default when they have none.
+func UserProvider(ctx context.Context, gcpCollection *mongo.Collection, userID primitive.ObjectID) (Provider, error) {
+	var creds models.GCPCredentials
+	err := gcpCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&creds)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error fetching credentials: %v", err)
+	}
+	return NewProvider(creds)
+}
@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	openAIDefaultBaseURL = "https://api.openai.com/v1"
+	openAIDefaultModel   = "gpt-4o-mini"
+	openAIRequestTimeout = 2 * time.Minute
+)
+
+// openAIProvider speaks the OpenAI /chat/completions API, which is also
+// implemented by local servers such as Ollama, vLLM and LocalAI.
+type openAIProvider struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+func newOpenAIProvider(baseURL, apiKey, model string) *openAIProvider {
+	if baseURL == "" {
+		baseURL = openAIDefaultBaseURL
+	}
+	if model == "" {
+		model = openAIDefaultModel
+	}
+	return &openAIProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: openAIRequestTimeout},
+	}
+}
+
+func (p *openAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+func (p *openAIProvider) Complete(ctx context.Context, messages []Message) (string, error) {
+	resp, err := p.post(ctx, messages, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading completion: %v", err)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message Message `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return "", fmt.Errorf("error decoding completion: %v", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("LLM provider returned no choices")
+	}
+	return strings.TrimSpace(completion.Choices[0].Message.Content), nil
+}
+
+// Stream requests the completion as server-sent events and passes on each
+// piece of content as it arrives.
+func (p *openAIProvider) Stream(ctx context.Context, messages []Message, onDelta func(string) error) (string, error) {
+	resp, err := p.post(ctx, messages, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var reply strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta Message `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("error decoding completion chunk: %v", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		delta := chunk.Choices[0].Delta.Content
+		reply.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return "", err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading completion stream: %v", err)
+	}
+	return strings.TrimSpace(reply.String()), nil
+}
+
+// post sends a chat completion request and checks the response status. The
+// caller closes the body.
+func (p *openAIProvider) post(ctx context.Context, messages []Message, stream bool) (*http.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":    p.model,
+		"messages": messages,
+		"stream":   stream,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding completion request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating completion request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting completion: %v", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, ErrUnauthorized
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 300))
+	return nil, fmt.Errorf("LLM provider returned status %d: %s", resp.StatusCode, message)
+}
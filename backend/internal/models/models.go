@@ -24,6 +24,9 @@ type TranscriptionSentence struct {
 	Confidence float64             `json:"confidence" bson:"confidence"`
 	Speaker    string              `json:"speaker" bson:"speaker"`
 	Channel    int                 `json:"channel" bson:"channel"`
+	// SpeakerName is the name of the person the speaker label is assigned
+	// to. It is resolved when the conversation is read and never stored.
+	SpeakerName string `json:"speaker_name,omitempty" bson:"-"`
 }
 
 type Conversation struct {
@@ -37,11 +40,66 @@ type Conversation struct {
 	ActionItems []string                `json:"action_items" bson:"action_items"`
 	CreatedAt   time.Time               `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time               `json:"updated_at" bson:"updated_at"`
+
+	TranscriptionStatus string                 `json:"transcription_status,omitempty" bson:"transcription_status,omitempty"`
+	Analysis            map[string]string      `json:"analysis,omitempty" bson:"analysis,omitempty"`
+	Metadata            *TranscriptionMetadata `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	Speakers            []SpeakerAssignment    `json:"speakers,omitempty" bson:"speakers,omitempty"`
+	Tags                []string               `json:"tags,omitempty" bson:"tags,omitempty"`
+	// DeletedAt is set while the conversation is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	// EmbeddedAt is the UpdatedAt of the version whose transcript chunks were
+	// last embedded, with EmbeddingModel the model that embedded them.
+	EmbeddedAt     *time.Time `json:"-" bson:"embedded_at,omitempty"`
+	EmbeddingModel string     `json:"-" bson:"embedding_model,omitempty"`
+	// ActionsSyncedAt is the UpdatedAt of the version whose action items were
+	// last copied to the action items collection. NeedsActionSync is set by
+	// writes that change the transcript, action items or speakers, until the
+	// change has been copied.
+	ActionsSyncedAt *time.Time `json:"-" bson:"actions_synced_at,omitempty"`
+	NeedsActionSync bool       `json:"-" bson:"needs_action_sync,omitempty"`
+}
+
+// SpeakerAssignment maps a transcript speaker label to a person in the
+// user's people directory.
+type SpeakerAssignment struct {
+	Label    string             `json:"label" bson:"label"`
+	PersonID primitive.ObjectID `json:"person_id" bson:"person_id"`
+	Name     string             `json:"name,omitempty" bson:"-"`
+}
+
+type Person struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name      string             `json:"name" bson:"name"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
+// TranscriptionMetadata describes how a conversation's transcript was
+// produced. Durations are in seconds.
+type TranscriptionMetadata struct {
+	Provider          string    `json:"provider" bson:"provider"`
+	ProviderJobID     string    `json:"provider_job_id,omitempty" bson:"provider_job_id,omitempty"`
+	AudioDuration     float64   `json:"audio_duration" bson:"audio_duration"`
+	BillingTime       float64   `json:"billing_time" bson:"billing_time"`
+	TranscriptionTime float64   `json:"transcription_time" bson:"transcription_time"`
+	Channels          int       `json:"channels" bson:"channels"`
+	Languages         []string  `json:"languages" bson:"languages"`
+	TranscribedAt     time.Time `json:"transcribed_at" bson:"transcribed_at"`
+}
+
+const (
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
+
+// ChatMessage is one message of a conversation's chat. Messages saved before
+// roles existed have no Role and were all written by the user.
 type ChatMessage struct {
 	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Role      string             `json:"role" bson:"role"`
 	Content   string             `json:"content" bson:"content"`
 	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
 }
@@ -50,15 +108,248 @@ type User struct {
 	ID       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	Email    string             `json:"email" bson:"email"`
 	Password string             `json:"password,omitempty" bson:"password"`
+	// TimeZone is the IANA zone dates said in conversations are read in,
+	// set with PUT /calendar/time-zone. Empty means UTC.
+	TimeZone string `json:"-" bson:"time_zone,omitempty"`
 }
 type GCPCredentials struct {
-	UserID      primitive.ObjectID `bson:"user_id"`
-	Credentials string             `bson:"credentials"`
-	BucketName  string             `bson:"bucket_name"`
-	GladiaKey   string             `bson:"gladia_key"`
+	UserID         primitive.ObjectID `json:"-" bson:"user_id"`
+	StorageBackend string             `json:"storage_backend" bson:"storage_backend"`
+	Credentials    string             `json:"credentials" bson:"credentials"`
+	BucketName     string             `json:"bucket_name" bson:"bucket_name"`
+	S3Endpoint     string             `json:"s3_endpoint" bson:"s3_endpoint"`
+	S3Region       string             `json:"s3_region" bson:"s3_region"`
+	S3AccessKey    string             `json:"s3_access_key" bson:"s3_access_key"`
+	S3SecretKey    string             `json:"s3_secret_key" bson:"s3_secret_key"`
+	S3Insecure     bool               `json:"s3_insecure" bson:"s3_insecure"`
+	GladiaKey      string             `json:"gladia_key" bson:"gladia_key"`
+
+	TranscriptionProvider string `json:"transcription_provider" bson:"transcription_provider"`
+	WhisperURL            string `json:"whisper_url" bson:"whisper_url"`
+	WhisperKey            string `json:"whisper_key" bson:"whisper_key"`
+	WhisperModel          string `json:"whisper_model" bson:"whisper_model"`
+
+	EmbeddingProvider string `json:"embedding_provider" bson:"embedding_provider"`
+	EmbeddingURL      string `json:"embedding_url" bson:"embedding_url"`
+	EmbeddingKey      string `json:"embedding_key" bson:"embedding_key"`
+	EmbeddingModel    string `json:"embedding_model" bson:"embedding_model"`
+
+	LLMProvider string `json:"llm_provider" bson:"llm_provider"`
+	LLMURL      string `json:"llm_url" bson:"llm_url"`
+	LLMKey      string `json:"llm_key" bson:"llm_key"`
+	LLMModel    string `json:"llm_model" bson:"llm_model"`
 }
 
 type AudioFile struct {
 	Name string `json:"name" bson:"name"`
 	URL  string `json:"url" bson:"url"`
 }
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	// JobHeld jobs wait, without using attempts, until NextRunAt; used while
+	// the user is over their monthly quota.
+	JobHeld = "held"
+)
+
+type TranscriptionJob struct {
+	ID             primitive.ObjectID    `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID         primitive.ObjectID    `json:"user_id" bson:"user_id"`
+	ConversationID primitive.ObjectID    `json:"conversation_id" bson:"conversation_id"`
+	State          string                `json:"state" bson:"state"`
+	Active         bool                  `json:"-" bson:"active,omitempty"`
+	Attempts       int                   `json:"attempts" bson:"attempts"`
+	MaxAttempts    int                   `json:"max_attempts" bson:"max_attempts"`
+	LastError      string                `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	Options        *TranscriptionOptions `json:"options,omitempty" bson:"options,omitempty"`
+	ProviderJobID  string                `json:"provider_job_id,omitempty" bson:"provider_job_id,omitempty"`
+	SubmittedAt    *time.Time            `json:"submitted_at,omitempty" bson:"submitted_at,omitempty"`
+	NextRunAt      time.Time             `json:"next_run_at" bson:"next_run_at"`
+	LeaseOwner     string                `json:"-" bson:"lease_owner,omitempty"`
+	LeaseExpiresAt time.Time             `json:"-" bson:"lease_expires_at,omitempty"`
+	CreatedAt      time.Time             `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at" bson:"updated_at"`
+	FinishedAt     *time.Time            `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
+
+// Prompt is a user-defined question asked about every transcript, such as
+// "decisions made". Answers are stored in Conversation.Analysis under Name.
+type Prompt struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name      string             `json:"name" bson:"name"`
+	Prompt    string             `json:"prompt" bson:"prompt"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// TranscriptionOptions are the per-request settings passed to a
+// transcription provider.
+type TranscriptionOptions struct {
+	Prompts []AnalysisPrompt `json:"prompts,omitempty" bson:"prompts,omitempty"`
+	// Language is an ISO 639-1 hint; empty lets the provider detect it.
+	Language string `json:"language,omitempty" bson:"language,omitempty"`
+	// Diarization turns speaker separation on or off; nil keeps the
+	// provider's default.
+	Diarization      *bool    `json:"diarization,omitempty" bson:"diarization,omitempty"`
+	SpeakerCount     int      `json:"speaker_count,omitempty" bson:"speaker_count,omitempty"`
+	CustomVocabulary []string `json:"custom_vocabulary,omitempty" bson:"custom_vocabulary,omitempty"`
+}
+
+// Revision sources record what produced a transcript revision.
+const (
+	RevisionOriginal      = "original"
+	RevisionTranscription = "transcription"
+	RevisionEdit          = "edit"
+	RevisionRestore       = "restore"
+)
+
+// TranscriptRevision is an immutable version of a conversation's transcript.
+// Revisions are numbered from 1 per conversation; the highest number is the
+// current transcript. AuthorID is the user who edited or restored it, and is
+// unset for transcriptions and for transcripts that predate revisions.
+type TranscriptRevision struct {
+	ID             primitive.ObjectID      `json:"id,omitempty" bson:"_id,omitempty"`
+	ConversationID primitive.ObjectID      `json:"conversation_id" bson:"conversation_id"`
+	UserID         primitive.ObjectID      `json:"user_id" bson:"user_id"`
+	Number         int                     `json:"number" bson:"number"`
+	Source         string                  `json:"source" bson:"source"`
+	AuthorID       *primitive.ObjectID     `json:"author_id,omitempty" bson:"author_id,omitempty"`
+	RestoredFrom   *primitive.ObjectID     `json:"restored_from,omitempty" bson:"restored_from,omitempty"`
+	Transcript     []TranscriptionSentence `json:"transcript,omitempty" bson:"transcript"`
+	Summary        string                  `json:"summary" bson:"summary"`
+	ActionItems    []string                `json:"action_items" bson:"action_items"`
+	Metadata       *TranscriptionMetadata  `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	CreatedAt      time.Time               `json:"created_at" bson:"created_at"`
+}
+
+type AnalysisPrompt struct {
+	Name   string `json:"name" bson:"name"`
+	Prompt string `json:"prompt" bson:"prompt"`
+}
+
+// UsageRecord is one completed transcription in the usage ledger. Seconds
+// are audio seconds as reported by the provider.
+type UsageRecord struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	ConversationID primitive.ObjectID `json:"conversation_id" bson:"conversation_id"`
+	JobID          primitive.ObjectID `json:"job_id" bson:"job_id"`
+	Provider       string             `json:"provider" bson:"provider"`
+	AudioSeconds   float64            `json:"audio_seconds" bson:"audio_seconds"`
+	BillingSeconds float64            `json:"billing_seconds" bson:"billing_seconds"`
+	Month          string             `json:"month" bson:"month"`
+	RecordedAt     time.Time          `json:"recorded_at" bson:"recorded_at"`
+}
+
+type UsageQuota struct {
+	UserID              primitive.ObjectID `json:"-" bson:"user_id"`
+	MonthlyAudioSeconds float64            `json:"monthly_audio_seconds" bson:"monthly_audio_seconds"`
+	UpdatedAt           time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// ArchiveExpired marks an archive export whose file has been deleted.
+const ArchiveExpired = "expired"
+
+// ArchiveExport is a request to package all of a user's data into a ZIP
+// file. It moves through the job states queued, running and succeeded or
+// failed, and becomes expired once the file is removed.
+type ArchiveExport struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	State          string             `json:"state" bson:"state"`
+	IncludeAudio   bool               `json:"include_audio" bson:"include_audio"`
+	Attempts       int                `json:"attempts" bson:"attempts"`
+	LastError      string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	Conversations  int                `json:"conversations" bson:"conversations"`
+	Size           int64              `json:"size" bson:"size"`
+	LeaseExpiresAt *time.Time         `json:"-" bson:"lease_expires_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+	FinishedAt     *time.Time         `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+	ExpiresAt      *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	DownloadURL    string             `json:"download_url,omitempty" bson:"-"`
+}
+
+// TranscriptChunk is a passage of consecutive transcript sentences and its
+// embedding, used for semantic search. Sentences FirstSentence through
+// LastSentence of the transcript make up Text; Start and End are in seconds.
+type TranscriptChunk struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	ConversationID primitive.ObjectID `json:"conversation_id" bson:"conversation_id"`
+	Model          string             `json:"model" bson:"model"`
+	Text           string             `json:"text" bson:"text"`
+	Speakers       []string           `json:"speakers" bson:"speakers"`
+	FirstSentence  int                `json:"first_sentence" bson:"first_sentence"`
+	LastSentence   int                `json:"last_sentence" bson:"last_sentence"`
+	Start          float64            `json:"start" bson:"start"`
+	End            float64            `json:"end" bson:"end"`
+	Vector         []float32          `json:"-" bson:"vector"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+}
+
+const (
+	ActionItemOpen      = "open"
+	ActionItemDone      = "done"
+	ActionItemDismissed = "dismissed"
+)
+
+const (
+	ActionItemSourceConversation = "conversation"
+	ActionItemSourceManual       = "manual"
+)
+
+// ActionItem is a task from a conversation. Items with source conversation
+// are copied from the conversation's action items, SourceText being the item
+// as extracted; SentenceIndex and Start locate the transcript sentence it came
+// from, when one was found. DueAt is a date, at midnight UTC.
+type ActionItem struct {
+	ID               primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID           primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	ConversationID   primitive.ObjectID  `json:"conversation_id" bson:"conversation_id"`
+	ConversationName string              `json:"conversation_name,omitempty" bson:"-"`
+	Text             string              `json:"text" bson:"text"`
+	Status           string              `json:"status" bson:"status"`
+	Source           string              `json:"source" bson:"source"`
+	SourceText       string              `json:"source_text,omitempty" bson:"source_text,omitempty"`
+	SentenceIndex    *int                `json:"sentence_index,omitempty" bson:"sentence_index,omitempty"`
+	Start            *float64            `json:"start,omitempty" bson:"start,omitempty"`
+	Speaker          string              `json:"speaker,omitempty" bson:"speaker,omitempty"`
+	AssigneeID       *primitive.ObjectID `json:"assignee_id,omitempty" bson:"assignee_id,omitempty"`
+	AssigneeName     string              `json:"assignee_name,omitempty" bson:"-"`
+	DueAt            *time.Time          `json:"due_at,omitempty" bson:"due_at,omitempty"`
+	CreatedAt        time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at" bson:"updated_at"`
+	CompletedAt      *time.Time          `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
+
+// Meeting is a meeting arranged in a conversation, found in the transcript
+// sentence at SentenceIndex. Key identifies the meeting within the
+// conversation by the sentence's text, so it stays the same while the
+// sentence does. Start is a local time with no time zone, kept as if it were
+// UTC; an AllDay meeting has only a date.
+type Meeting struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	ConversationID primitive.ObjectID `json:"conversation_id" bson:"conversation_id"`
+	Key            string             `json:"key" bson:"key"`
+	SentenceIndex  int                `json:"sentence_index" bson:"sentence_index"`
+	Text           string             `json:"text" bson:"text"`
+	Start          time.Time          `json:"start" bson:"start"`
+	AllDay         bool               `json:"all_day" bson:"all_day"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// CalendarFeed is a user's subscribable calendar. Its URL carries a token
+// derived from the ID, so deleting the feed revokes every copy of the URL.
+type CalendarFeed struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	URL       string             `json:"url,omitempty" bson:"-"`
+	TimeZone  string             `json:"time_zone" bson:"-"`
+}
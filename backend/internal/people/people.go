@@ -0,0 +1,241 @@
+package people
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+func EnsureIndexes(ctx context.Context, peopleCollection, conversationsCollection *mongo.Collection) error {
+	_, err := peopleCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = conversationsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "speakers.person_id", Value: 1}},
+	})
+	return err
+}
+
+// Resolve fills in the names of the people assigned to the conversation's
+// speakers, both on the assignments and on each transcript sentence.
+func Resolve(ctx context.Context, peopleCollection *mongo.Collection, conversation *models.Conversation) error {
+	if len(conversation.Speakers) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, len(conversation.Speakers))
+	for i, speaker := range conversation.Speakers {
+		ids[i] = speaker.PersonID
+	}
+	names, err := namesByID(ctx, peopleCollection, conversation.UserID, ids)
+	if err != nil {
+		return err
+	}
+
+	byLabel := map[string]string{}
+	for i, speaker := range conversation.Speakers {
+		conversation.Speakers[i].Name = names[speaker.PersonID]
+		byLabel[speaker.Label] = names[speaker.PersonID]
+	}
+	for i, sentence := range conversation.Transcript {
+		conversation.Transcript[i].SpeakerName = byLabel[sentence.Speaker]
+	}
+	return nil
+}
+
+func namesByID(ctx context.Context, peopleCollection *mongo.Collection, userID primitive.ObjectID, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	cursor, err := peopleCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	names := map[primitive.ObjectID]string{}
+	for cursor.Next(ctx) {
+		var person models.Person
+		if err := cursor.Decode(&person); err != nil {
+			return nil, err
+		}
+		names[person.ID] = person.Name
+	}
+	return names, cursor.Err()
+}
+
+// findOrCreate returns the user's person with the given name, creating it if
+// there is none.
+func findOrCreate(ctx context.Context, peopleCollection *mongo.Collection, userID primitive.ObjectID, name string) (primitive.ObjectID, error) {
+	now := time.Now()
+	var person models.Person
+	err := peopleCollection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID, "name": name},
+		bson.M{"$setOnInsert": models.Person{UserID: userID, Name: name, CreatedAt: now, UpdatedAt: now}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&person)
+	if mongo.IsDuplicateKeyError(err) {
+		err = peopleCollection.FindOne(ctx, bson.M{"user_id": userID, "name": name}).Decode(&person)
+	}
+	return person.ID, err
+}
+
+func GetPeople(peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		cursor, err := peopleCollection.Find(context.TODO(), bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+		if err != nil {
+			http.Error(w, "Error fetching people", http.StatusInternalServerError)
+			return
+		}
+		defer cursor.Close(context.TODO())
+
+		people := []models.Person{}
+		if err := cursor.All(context.TODO(), &people); err != nil {
+			http.Error(w, "Error decoding people", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(people)
+	}
+}
+
+func CreatePerson(peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var person models.Person
+		_ = json.NewDecoder(r.Body).Decode(&person)
+		person.Name = strings.TrimSpace(person.Name)
+		if person.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		person.ID = primitive.NilObjectID
+		person.UserID = userID
+		person.CreatedAt = time.Now()
+		person.UpdatedAt = time.Now()
+
+		result, err := peopleCollection.InsertOne(context.TODO(), person)
+		if mongo.IsDuplicateKeyError(err) {
+			http.Error(w, "A person with this name already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error creating person", http.StatusInternalServerError)
+			return
+		}
+		person.ID = result.InsertedID.(primitive.ObjectID)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(person)
+	}
+}
+
+func UpdatePerson(peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		personID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update models.Person
+		_ = json.NewDecoder(r.Body).Decode(&update)
+		update.Name = strings.TrimSpace(update.Name)
+		if update.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		var person models.Person
+		err = peopleCollection.FindOneAndUpdate(
+			context.TODO(),
+			bson.M{"_id": personID, "user_id": userID},
+			bson.M{"$set": bson.M{"name": update.Name, "updated_at": time.Now()}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&person)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Person not found", http.StatusNotFound)
+			return
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			http.Error(w, "A person with this name already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error updating person", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(person)
+	}
+}
+
+// DeletePerson removes a person and unassigns them from every conversation
+// and action item.
+func DeletePerson(peopleCollection, conversationsCollection, actionItemsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		personID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		result, err := peopleCollection.DeleteOne(context.TODO(), bson.M{"_id": personID, "user_id": userID})
+		if err != nil {
+			http.Error(w, "Error deleting person", http.StatusInternalServerError)
+			return
+		}
+		if result.DeletedCount == 0 {
+			http.Error(w, "Person not found", http.StatusNotFound)
+			return
+		}
+
+		_, err = conversationsCollection.UpdateMany(context.TODO(),
+			bson.M{"user_id": userID, "speakers.person_id": personID},
+			bson.M{"$pull": bson.M{"speakers": bson.M{"person_id": personID}}},
+		)
+		if err != nil {
+			http.Error(w, "Error unassigning person from conversations", http.StatusInternalServerError)
+			return
+		}
+		_, err = actionItemsCollection.UpdateMany(context.TODO(),
+			bson.M{"user_id": userID, "assignee_id": personID},
+			bson.M{"$unset": bson.M{"assignee_id": ""}},
+		)
+		if err != nil {
+			http.Error(w, "Error unassigning person from action items", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"message": "Person deleted successfully"})
+	}
+}
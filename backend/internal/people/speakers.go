@@ -0,0 +1,209 @@
+package people
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// PersonConversation is one conversation a person speaks in. TalkTime is
+// the total length in seconds of the sentences attributed to them.
+type PersonConversation struct {
+	ConversationID primitive.ObjectID `json:"conversation_id"`
+	Name           string             `json:"name"`
+	Labels         []string           `json:"labels"`
+	TalkTime       float64            `json:"talk_time"`
+	Sentences      int                `json:"sentences"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+// AssignSpeakers maps the conversation's speaker labels to people. Each
+// entry names the person either by person_id or by name, in which case the
+// person is created if needed; an entry with neither unassigns the label.
+// Labels not mentioned keep their current assignment.
+func AssignSpeakers(conversationsCollection, peopleCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Speakers []struct {
+				Label    string `json:"label"`
+				PersonID string `json:"person_id"`
+				Name     string `json:"name"`
+			} `json:"speakers"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Speakers) == 0 {
+			http.Error(w, "Invalid speakers", http.StatusBadRequest)
+			return
+		}
+
+		var conversation models.Conversation
+		err = conversationsCollection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil}).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
+			return
+		}
+
+		labels := map[string]bool{}
+		for _, sentence := range conversation.Transcript {
+			labels[sentence.Speaker] = true
+		}
+		assigned := map[string]primitive.ObjectID{}
+		for _, speaker := range conversation.Speakers {
+			assigned[speaker.Label] = speaker.PersonID
+		}
+
+		for _, speaker := range request.Speakers {
+			if !labels[speaker.Label] {
+				http.Error(w, "Unknown speaker label "+speaker.Label, http.StatusBadRequest)
+				return
+			}
+			name := strings.TrimSpace(speaker.Name)
+			switch {
+			case speaker.PersonID != "":
+				personID, err := primitive.ObjectIDFromHex(speaker.PersonID)
+				if err != nil {
+					http.Error(w, "Person not found", http.StatusBadRequest)
+					return
+				}
+				count, err := peopleCollection.CountDocuments(context.TODO(), bson.M{"_id": personID, "user_id": userID})
+				if err != nil {
+					http.Error(w, "Error fetching person", http.StatusInternalServerError)
+					return
+				}
+				if count == 0 {
+					http.Error(w, "Person not found", http.StatusBadRequest)
+					return
+				}
+				assigned[speaker.Label] = personID
+			case name != "":
+				personID, err := findOrCreate(context.TODO(), peopleCollection, userID, name)
+				if err != nil {
+					http.Error(w, "Error creating person", http.StatusInternalServerError)
+					return
+				}
+				assigned[speaker.Label] = personID
+			default:
+				delete(assigned, speaker.Label)
+			}
+		}
+
+		speakers := []models.SpeakerAssignment{}
+		for label, personID := range assigned {
+			speakers = append(speakers, models.SpeakerAssignment{Label: label, PersonID: personID})
+		}
+		sort.Slice(speakers, func(i, j int) bool { return speakers[i].Label < speakers[j].Label })
+
+		result, err := conversationsCollection.UpdateOne(context.TODO(),
+			bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil},
+			bson.M{"$set": bson.M{"speakers": speakers, "updated_at": time.Now(), "needs_action_sync": true}},
+		)
+		if err != nil {
+			http.Error(w, "Error saving speakers", http.StatusInternalServerError)
+			return
+		}
+		if result.MatchedCount == 0 {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+
+		conversation.Speakers = speakers
+		if err := Resolve(context.TODO(), peopleCollection, &conversation); err != nil {
+			http.Error(w, "Error resolving speaker names", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(conversation.Speakers)
+	}
+}
+
+// GetPersonConversations lists the conversations a person has been assigned
+// to, newest first, with how long they spoke in each.
+func GetPersonConversations(peopleCollection, conversationsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		personID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		count, err := peopleCollection.CountDocuments(context.TODO(), bson.M{"_id": personID, "user_id": userID})
+		if err != nil {
+			http.Error(w, "Error fetching person", http.StatusInternalServerError)
+			return
+		}
+		if count == 0 {
+			http.Error(w, "Person not found", http.StatusNotFound)
+			return
+		}
+
+		cursor, err := conversationsCollection.Find(context.TODO(),
+			bson.M{"user_id": userID, "speakers.person_id": personID, "deleted_at": nil},
+			options.Find().
+				SetSort(bson.D{{Key: "created_at", Value: -1}}).
+				SetProjection(bson.M{"name": 1, "created_at": 1, "speakers": 1, "transcript.speaker": 1, "transcript.start": 1, "transcript.end": 1}),
+		)
+		if err != nil {
+			http.Error(w, "Error fetching conversations", http.StatusInternalServerError)
+			return
+		}
+		defer cursor.Close(context.TODO())
+
+		results := []PersonConversation{}
+		for cursor.Next(context.TODO()) {
+			var conversation models.Conversation
+			if err := cursor.Decode(&conversation); err != nil {
+				http.Error(w, "Error decoding conversation", http.StatusInternalServerError)
+				return
+			}
+
+			result := PersonConversation{
+				ConversationID: conversation.ID,
+				Name:           conversation.Name,
+				Labels:         []string{},
+				CreatedAt:      conversation.CreatedAt,
+			}
+			labels := map[string]bool{}
+			for _, speaker := range conversation.Speakers {
+				if speaker.PersonID == personID {
+					labels[speaker.Label] = true
+					result.Labels = append(result.Labels, speaker.Label)
+				}
+			}
+			for _, sentence := range conversation.Transcript {
+				if labels[sentence.Speaker] {
+					result.TalkTime += sentence.End - sentence.Start
+					result.Sentences++
+				}
+			}
+			results = append(results, result)
+		}
+
+		json.NewEncoder(w).Encode(results)
+	}
+}
@@ -0,0 +1,252 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/gcp"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/jobs"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/prompts"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/revisions"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/transcription"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/usage"
+)
+
+// callbackTimeout bounds how long a job submitted with a callback URL may
+// stay outstanding before it is treated as failed.
+const callbackTimeout = 6 * time.Hour
+
+// Pipeline turns a queued transcription job into a transcript stored on the
+// conversation. Its Transcribe method is the jobs.ProcessFunc run by the worker.
+type Pipeline struct {
+	conversations *mongo.Collection
+	credentials   *mongo.Collection
+	prompts       *mongo.Collection
+	revisions     *mongo.Collection
+	queue         *jobs.Queue
+	ledger        *usage.Ledger
+}
+
+func New(conversationsCollection, gcpCredentialsCollection, promptsCollection, revisionsCollection *mongo.Collection, queue *jobs.Queue, ledger *usage.Ledger) *Pipeline {
+	return &Pipeline{
+		conversations: conversationsCollection,
+		credentials:   gcpCredentialsCollection,
+		prompts:       promptsCollection,
+		revisions:     revisionsCollection,
+		queue:         queue,
+		ledger:        ledger,
+	}
+}
+
+// Transcribe runs one attempt of a job. Providers that support callbacks are
+// submitted and the job parked until the webhook arrives; when a parked job's
+// lease runs out first, this checks on the provider once instead of
+// resubmitting.
+func (p *Pipeline) Transcribe(ctx context.Context, job *models.TranscriptionJob) error {
+	var conversation models.Conversation
+	err := p.conversations.FindOne(ctx, bson.M{"_id": job.ConversationID, "user_id": job.UserID}).Decode(&conversation)
+	if err == mongo.ErrNoDocuments {
+		return jobs.Permanent(fmt.Errorf("conversation has been deleted"))
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching conversation: %v", err)
+	}
+	if conversation.DeletedAt != nil {
+		return jobs.Permanent(fmt.Errorf("conversation is in the trash"))
+	}
+	if conversation.AudioFile == nil {
+		return jobs.Permanent(fmt.Errorf("conversation has no audio file"))
+	}
+
+	store, creds, err := gcp.OpenUserBlobStore(ctx, p.credentials, job.UserID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	provider, err := transcription.NewProvider(creds)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	async, isAsync := provider.(transcription.AsyncProvider)
+
+	if job.ProviderJobID != "" && isAsync {
+		if job.SubmittedAt != nil && time.Since(*job.SubmittedAt) > callbackTimeout {
+			return fmt.Errorf("timed out waiting for %s to finish transcription %s", provider.Name(), job.ProviderJobID)
+		}
+		result, done, err := async.Fetch(ctx, job.ProviderJobID, jobOptions(job))
+		if err != nil {
+			return classify(err)
+		}
+		if !done {
+			return jobs.ErrAwaitCallback
+		}
+		return p.apply(ctx, job, conversation, provider.Name(), result)
+	}
+
+	signedURL, err := store.SignURL(ctx, conversation.AudioFile.Name, time.Hour)
+	if err != nil {
+		return err
+	}
+
+	opts := jobOptions(job)
+	opts.Prompts, err = prompts.ForUser(ctx, p.prompts, job.UserID)
+	if err != nil {
+		return fmt.Errorf("error fetching prompts: %v", err)
+	}
+
+	if baseURL := os.Getenv("PUBLIC_BASE_URL"); isAsync && baseURL != "" {
+		callbackURL := fmt.Sprintf("%s/webhooks/%s?job=%s&token=%s",
+			strings.TrimSuffix(baseURL, "/"), provider.Name(), job.ID.Hex(), callbackToken(job.ID))
+		providerJobID, err := async.Submit(ctx, signedURL, callbackURL, opts)
+		if err != nil {
+			return classify(fmt.Errorf("error submitting transcription: %w", err))
+		}
+		if err := p.queue.SetProviderJob(ctx, job, providerJobID, opts); err != nil {
+			return err
+		}
+		return jobs.ErrAwaitCallback
+	}
+
+	result, err := provider.Transcribe(ctx, signedURL, opts)
+	if err != nil {
+		return classify(fmt.Errorf("error transcribing audio: %w", err))
+	}
+	return p.apply(ctx, job, conversation, provider.Name(), result)
+}
+
+// classify tells the job queue whether a provider error is worth retrying.
+// A rejected key or unreachable audio fails the job straight away; quota and
+// rate limit errors wait at least as long as the provider asked.
+func classify(err error) error {
+	if !transcription.Retryable(err) {
+		return jobs.Permanent(err)
+	}
+	if delay := transcription.RetryAfter(err); delay > 0 {
+		return jobs.RetryAfter(err, delay)
+	}
+	return err
+}
+
+// apply stores a finished transcription on its conversation, records it as a
+// transcript revision and records it in the usage ledger. A generated title
+// replaces the name only while the conversation is still named after its
+// audio file, so names chosen by the user are kept.
+func (p *Pipeline) apply(ctx context.Context, job *models.TranscriptionJob, conversation models.Conversation, provider string, result *transcription.Result) error {
+	// A transcript written after the job was created came from this job, e.g.
+	// via the webhook before a worker's fetch; there is nothing left to do.
+	if conversation.Metadata != nil && conversation.Metadata.TranscribedAt.After(job.CreatedAt) {
+		return nil
+	}
+	metadata := models.TranscriptionMetadata{
+		Provider:          provider,
+		ProviderJobID:     result.ProviderJobID,
+		AudioDuration:     result.Metadata.AudioDuration,
+		BillingTime:       result.Metadata.BillingTime,
+		TranscriptionTime: result.Metadata.TranscriptionTime,
+		Channels:          result.Metadata.Channels,
+		Languages:         result.Languages,
+		TranscribedAt:     time.Now(),
+	}
+	set := bson.M{
+		"transcript":        result.Sentences,
+		"summary":           result.Summary,
+		"action_items":      result.ActionItems,
+		"metadata":          metadata,
+		"updated_at":        time.Now(),
+		"needs_action_sync": true,
+	}
+	if result.Title != "" && namedAfterAudioFile(conversation) {
+		set["name"] = result.Title
+	}
+	// Answers always come from the latest prompts, so those to prompts since
+	// deleted do not linger.
+	update := bson.M{"$set": set}
+	if len(result.Analysis) > 0 {
+		set["analysis"] = result.Analysis
+	} else {
+		update["$unset"] = bson.M{"analysis": ""}
+	}
+
+	// The webhook and a worker whose callback wait ran out can both complete
+	// the same job. Only the first write matches; the other stops here, so
+	// the revision and usage are recorded once. Nor is a conversation moved
+	// to the trash meanwhile written to or billed.
+	updated, err := p.conversations.UpdateOne(ctx,
+		bson.M{
+			"_id":                     conversation.ID,
+			"deleted_at":              nil,
+			"metadata.transcribed_at": bson.M{"$not": bson.M{"$gte": job.CreatedAt}},
+		},
+		update,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating conversation with transcription: %v", err)
+	}
+	if updated.MatchedCount == 0 {
+		return nil
+	}
+
+	// The transcript read before the write is kept as the first revision if
+	// it has none yet.
+	if err := revisions.Baseline(ctx, p.revisions, conversation); err != nil {
+		log.Printf("Error recording original transcript revision for job %s: %v", job.ID.Hex(), err)
+	}
+	_, err = revisions.Record(ctx, p.revisions, models.TranscriptRevision{
+		ConversationID: conversation.ID,
+		UserID:         job.UserID,
+		Source:         models.RevisionTranscription,
+		Transcript:     result.Sentences,
+		Summary:        result.Summary,
+		ActionItems:    result.ActionItems,
+		Metadata:       &metadata,
+	})
+	if err != nil {
+		log.Printf("Error recording transcript revision for job %s: %v", job.ID.Hex(), err)
+	}
+
+	err = p.ledger.Record(ctx, models.UsageRecord{
+		UserID:         job.UserID,
+		ConversationID: conversation.ID,
+		JobID:          job.ID,
+		Provider:       provider,
+		AudioSeconds:   result.Metadata.AudioDuration,
+		BillingSeconds: result.Metadata.BillingTime,
+	})
+	if err != nil {
+		// The transcript is saved; failing the job now would only transcribe
+		// (and bill) the audio a second time.
+		log.Printf("Error recording usage for transcription job %s: %v", job.ID.Hex(), err)
+	}
+	return nil
+}
+
+// jobOptions returns the options a job was created or submitted with.
+func jobOptions(job *models.TranscriptionJob) models.TranscriptionOptions {
+	if job.Options == nil {
+		return models.TranscriptionOptions{}
+	}
+	return *job.Options
+}
+
+// namedAfterAudioFile reports whether the conversation still has the name it
+// was given on creation: the object name without extension for bucket
+// imports, or the original file name for uploads (stored as "<nanos>_<name>").
+func namedAfterAudioFile(conversation models.Conversation) bool {
+	if conversation.AudioFile == nil {
+		return false
+	}
+	base := filepath.Base(conversation.AudioFile.Name)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	name := conversation.Name
+	return name == "" || name == base || name == stem || strings.HasSuffix(base, "_"+name)
+}
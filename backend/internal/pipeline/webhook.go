@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/jobs"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/transcription"
+)
+
+type gladiaCallback struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+}
+
+// callbackToken authenticates provider callbacks for a job. It is embedded in
+// the callback URL handed to the provider, since providers cannot send our
+// JWTs.
+func callbackToken(jobID primitive.ObjectID) string {
+	mac := hmac.New(sha256.New, models.JWTSecret)
+	mac.Write([]byte("transcription-callback\n" + jobID.Hex()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GladiaWebhook receives Gladia's completion callback. The callback body is
+// only trusted for the Gladia job ID: the result itself is fetched back from
+// Gladia with the user's key before it is written to the conversation.
+func GladiaWebhook(p *Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		jobID, err := primitive.ObjectIDFromHex(r.URL.Query().Get("job"))
+		if err != nil {
+			http.Error(w, "Invalid job", http.StatusBadRequest)
+			return
+		}
+		if !hmac.Equal([]byte(callbackToken(jobID)), []byte(r.URL.Query().Get("token"))) {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		var callback gladiaCallback
+		if err := json.NewDecoder(r.Body).Decode(&callback); err != nil {
+			http.Error(w, "Invalid callback body", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.Background()
+		job, err := p.queue.Get(ctx, jobID)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching job", http.StatusInternalServerError)
+			return
+		}
+		if job.ProviderJobID == "" || job.ProviderJobID != callback.ID {
+			http.Error(w, "Callback does not match job", http.StatusForbidden)
+			return
+		}
+		if job.State != models.JobRunning {
+			json.NewEncoder(w).Encode(map[string]string{"message": "Job already finished"})
+			return
+		}
+
+		if err := p.collect(ctx, job); err != nil {
+			// Let a worker pick the job up now rather than after the full
+			// callback wait; it will fetch again and retry or fail the job.
+			log.Printf("Error handling Gladia callback for job %s (%s): %v", job.ID.Hex(), callback.Event, err)
+			if err := p.queue.Wake(ctx, job); err != nil {
+				log.Printf("Error waking transcription job %s: %v", job.ID.Hex(), err)
+			}
+			json.NewEncoder(w).Encode(map[string]string{"message": "Callback received"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"message": "Transcript saved"})
+	}
+}
+
+// collect fetches the finished result of a parked job and completes it.
+func (p *Pipeline) collect(ctx context.Context, job *models.TranscriptionJob) error {
+	var conversation models.Conversation
+	err := p.conversations.FindOne(ctx, bson.M{"_id": job.ConversationID, "user_id": job.UserID}).Decode(&conversation)
+	if err != nil {
+		return err
+	}
+	if conversation.DeletedAt != nil {
+		return fmt.Errorf("conversation is in the trash")
+	}
+
+	var creds models.GCPCredentials
+	if err := p.credentials.FindOne(ctx, bson.M{"user_id": job.UserID}).Decode(&creds); err != nil {
+		return err
+	}
+	provider, err := transcription.NewProvider(creds)
+	if err != nil {
+		return err
+	}
+	async, ok := provider.(transcription.AsyncProvider)
+	if !ok {
+		return jobs.ErrAwaitCallback
+	}
+
+	result, done, err := async.Fetch(ctx, job.ProviderJobID, jobOptions(job))
+	if err != nil {
+		return err
+	}
+	if !done {
+		return jobs.ErrAwaitCallback
+	}
+
+	if err := p.apply(ctx, job, conversation, provider.Name(), result); err != nil {
+		return err
+	}
+	return p.queue.CompleteCallback(ctx, job)
+}
@@ -0,0 +1,213 @@
+package prompts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// maxPrompts keeps the number of LLM questions sent with each transcription,
+// and so its cost and latency, bounded.
+const maxPrompts = 10
+
+// ValidName reports whether a prompt name can be used as a key of a
+// conversation's analysis, which Mongo stores as field names: it must not
+// contain "." or start with "$".
+func ValidName(name string) bool {
+	return !strings.Contains(name, ".") && !strings.HasPrefix(name, "$")
+}
+
+func EnsureIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// ForUser returns the user's prompts in the form sent to a transcription
+// provider, oldest first.
+func ForUser(ctx context.Context, collection *mongo.Collection, userID primitive.ObjectID) ([]models.AnalysisPrompt, error) {
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var analysisPrompts []models.AnalysisPrompt
+	for cursor.Next(ctx) {
+		var prompt models.Prompt
+		if err := cursor.Decode(&prompt); err != nil {
+			return nil, err
+		}
+		// Prompts saved before names were validated would break the write
+		// of the analysis.
+		if !ValidName(prompt.Name) {
+			continue
+		}
+		analysisPrompts = append(analysisPrompts, models.AnalysisPrompt{Name: prompt.Name, Prompt: prompt.Prompt})
+	}
+	return analysisPrompts, cursor.Err()
+}
+
+func GetPrompts(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		cursor, err := collection.Find(context.TODO(), bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+		if err != nil {
+			http.Error(w, "Error fetching prompts", http.StatusInternalServerError)
+			return
+		}
+		defer cursor.Close(context.TODO())
+
+		prompts := []models.Prompt{}
+		if err := cursor.All(context.TODO(), &prompts); err != nil {
+			http.Error(w, "Error decoding prompts", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(prompts)
+	}
+}
+
+func CreatePrompt(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var prompt models.Prompt
+		_ = json.NewDecoder(r.Body).Decode(&prompt)
+		prompt.Name = strings.TrimSpace(prompt.Name)
+		prompt.Prompt = strings.TrimSpace(prompt.Prompt)
+		if prompt.Name == "" || prompt.Prompt == "" {
+			http.Error(w, "Name and prompt are required", http.StatusBadRequest)
+			return
+		}
+		if !ValidName(prompt.Name) {
+			http.Error(w, `Name must not contain "." or start with "$"`, http.StatusBadRequest)
+			return
+		}
+
+		count, err := collection.CountDocuments(context.TODO(), bson.M{"user_id": userID})
+		if err != nil {
+			http.Error(w, "Error creating prompt", http.StatusInternalServerError)
+			return
+		}
+		if count >= maxPrompts {
+			http.Error(w, "Too many prompts", http.StatusBadRequest)
+			return
+		}
+
+		prompt.ID = primitive.NilObjectID
+		prompt.UserID = userID
+		prompt.CreatedAt = time.Now()
+		prompt.UpdatedAt = time.Now()
+
+		result, err := collection.InsertOne(context.TODO(), prompt)
+		if mongo.IsDuplicateKeyError(err) {
+			http.Error(w, "A prompt with this name already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error creating prompt", http.StatusInternalServerError)
+			return
+		}
+		prompt.ID = result.InsertedID.(primitive.ObjectID)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(prompt)
+	}
+}
+
+func UpdatePrompt(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		promptID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update models.Prompt
+		_ = json.NewDecoder(r.Body).Decode(&update)
+		update.Name = strings.TrimSpace(update.Name)
+		update.Prompt = strings.TrimSpace(update.Prompt)
+		if update.Name == "" || update.Prompt == "" {
+			http.Error(w, "Name and prompt are required", http.StatusBadRequest)
+			return
+		}
+		if !ValidName(update.Name) {
+			http.Error(w, `Name must not contain "." or start with "$"`, http.StatusBadRequest)
+			return
+		}
+
+		var prompt models.Prompt
+		err = collection.FindOneAndUpdate(
+			context.TODO(),
+			bson.M{"_id": promptID, "user_id": userID},
+			bson.M{"$set": bson.M{"name": update.Name, "prompt": update.Prompt, "updated_at": time.Now()}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&prompt)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Prompt not found", http.StatusNotFound)
+			return
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			http.Error(w, "A prompt with this name already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error updating prompt", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(prompt)
+	}
+}
+
+func DeletePrompt(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		promptID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		result, err := collection.DeleteOne(context.TODO(), bson.M{"_id": promptID, "user_id": userID})
+		if err != nil {
+			http.Error(w, "Error deleting prompt", http.StatusInternalServerError)
+			return
+		}
+		if result.DeletedCount == 0 {
+			http.Error(w, "Prompt not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"message": "Prompt deleted successfully"})
+	}
+}
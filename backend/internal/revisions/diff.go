@@ -0,0 +1,126 @@
+package revisions
+
+import (
+	"strings"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// maxDiffCells bounds the LCS table. Beyond it the changed middle of the two
+// transcripts is reported as a block of deletions followed by insertions.
+const maxDiffCells = 4_000_000
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffChange is one sentence in a sentence-level diff. FromIndex and ToIndex
+// are positions in the old and new transcripts; only the ones that apply to
+// the change's op are set.
+type DiffChange struct {
+	Op        string                       `json:"op"`
+	FromIndex *int                         `json:"from_index,omitempty"`
+	ToIndex   *int                         `json:"to_index,omitempty"`
+	Sentence  models.TranscriptionSentence `json:"sentence"`
+}
+
+// Diff compares two transcripts sentence by sentence. Sentences are equal
+// when their speaker and text match; timing and confidence are ignored.
+func Diff(from, to []models.TranscriptionSentence) []DiffChange {
+	changes := []DiffChange{}
+
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && sameSentence(from[prefix], to[prefix]) {
+		changes = append(changes, equalChange(prefix, prefix, to[prefix]))
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix &&
+		sameSentence(from[len(from)-1-suffix], to[len(to)-1-suffix]) {
+		suffix++
+	}
+
+	oldMiddle := from[prefix : len(from)-suffix]
+	newMiddle := to[prefix : len(to)-suffix]
+	changes = append(changes, diffMiddle(oldMiddle, newMiddle, prefix)...)
+
+	for i := 0; i < suffix; i++ {
+		fromIndex, toIndex := len(from)-suffix+i, len(to)-suffix+i
+		changes = append(changes, equalChange(fromIndex, toIndex, to[toIndex]))
+	}
+	return changes
+}
+
+// diffMiddle diffs the part of two transcripts between their common prefix
+// and suffix using a longest common subsequence table. offset is the index
+// of the first sentence in both transcripts.
+func diffMiddle(from, to []models.TranscriptionSentence, offset int) []DiffChange {
+	var changes []DiffChange
+	if len(from)*len(to) > maxDiffCells {
+		for i, sentence := range from {
+			changes = append(changes, deleteChange(offset+i, sentence))
+		}
+		for j, sentence := range to {
+			changes = append(changes, insertChange(offset+j, sentence))
+		}
+		return changes
+	}
+
+	// lcs[i][j] is the LCS length of from[i:] and to[j:].
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if sameSentence(from[i], to[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case sameSentence(from[i], to[j]):
+			changes = append(changes, equalChange(offset+i, offset+j, to[j]))
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			changes = append(changes, deleteChange(offset+i, from[i]))
+			i++
+		default:
+			changes = append(changes, insertChange(offset+j, to[j]))
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		changes = append(changes, deleteChange(offset+i, from[i]))
+	}
+	for ; j < len(to); j++ {
+		changes = append(changes, insertChange(offset+j, to[j]))
+	}
+	return changes
+}
+
+func sameSentence(a, b models.TranscriptionSentence) bool {
+	return a.Speaker == b.Speaker && strings.TrimSpace(a.Sentence) == strings.TrimSpace(b.Sentence)
+}
+
+func equalChange(fromIndex, toIndex int, sentence models.TranscriptionSentence) DiffChange {
+	return DiffChange{Op: DiffEqual, FromIndex: &fromIndex, ToIndex: &toIndex, Sentence: sentence}
+}
+
+func deleteChange(fromIndex int, sentence models.TranscriptionSentence) DiffChange {
+	return DiffChange{Op: DiffDelete, FromIndex: &fromIndex, Sentence: sentence}
+}
+
+func insertChange(toIndex int, sentence models.TranscriptionSentence) DiffChange {
+	return DiffChange{Op: DiffInsert, ToIndex: &toIndex, Sentence: sentence}
+}
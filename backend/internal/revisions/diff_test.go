@@ -0,0 +1,114 @@
+package revisions
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// sentences builds a transcript from "speaker:text" pairs.
+func sentences(lines ...string) []models.TranscriptionSentence {
+	result := make([]models.TranscriptionSentence, len(lines))
+	for i, line := range lines {
+		speaker, text, _ := strings.Cut(line, ":")
+		result[i] = models.TranscriptionSentence{Speaker: speaker, Sentence: text, Start: float64(i)}
+	}
+	return result
+}
+
+// describe renders changes as "=from,to text", "-from text" and "+to text".
+func describe(changes []DiffChange) string {
+	parts := make([]string, len(changes))
+	for i, change := range changes {
+		switch change.Op {
+		case DiffEqual:
+			parts[i] = fmt.Sprintf("=%d,%d %s", *change.FromIndex, *change.ToIndex, change.Sentence.Sentence)
+		case DiffDelete:
+			parts[i] = fmt.Sprintf("-%d %s", *change.FromIndex, change.Sentence.Sentence)
+		case DiffInsert:
+			parts[i] = fmt.Sprintf("+%d %s", *change.ToIndex, change.Sentence.Sentence)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to []models.TranscriptionSentence
+		want     string
+	}{
+		{"identical", sentences("A:one", "B:two"), sentences("A:one", "B:two"),
+			"=0,0 one | =1,1 two"},
+		{"both empty", nil, nil, ""},
+		{"from empty", nil, sentences("A:one"), "+0 one"},
+		{"to empty", sentences("A:one"), nil, "-0 one"},
+		{"edited sentence", sentences("A:one", "B:two", "A:three"), sentences("A:one", "B:too", "A:three"),
+			"=0,0 one | -1 two | +1 too | =2,2 three"},
+		{"inserted sentence", sentences("A:one", "A:three"), sentences("A:one", "B:two", "A:three"),
+			"=0,0 one | +1 two | =1,2 three"},
+		{"deleted sentence", sentences("A:one", "B:two", "A:three"), sentences("A:one", "A:three"),
+			"=0,0 one | -1 two | =2,1 three"},
+		{"speaker change", sentences("A:one", "B:two"), sentences("A:one", "C:two"),
+			"=0,0 one | -1 two | +1 two"},
+		{"moved sentence", sentences("A:one", "B:two", "C:three", "D:four"), sentences("A:one", "C:three", "B:two", "D:four"),
+			"=0,0 one | -1 two | =2,1 three | +2 two | =3,3 four"},
+		{"split sentence", sentences("A:one two", "B:three"), sentences("A:one", "A:two", "B:three"),
+			"-0 one two | +0 one | +1 two | =1,2 three"},
+		{"repeated sentences", sentences("A:yes", "A:no", "A:yes"), sentences("A:yes", "A:yes"),
+			"=0,0 yes | -1 no | =2,1 yes"},
+		{"surrounding space is ignored", sentences("A: one "), sentences("A:one"),
+			"=0,0 one"},
+	}
+	for _, test := range tests {
+		if got := describe(Diff(test.from, test.to)); got != test.want {
+			t.Errorf("%s:\n got %s\nwant %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDiffTimingIgnored(t *testing.T) {
+	from := sentences("A:one")
+	to := sentences("A:one")
+	to[0].Start, to[0].End, to[0].Confidence = 5, 6, 0.5
+	changes := Diff(from, to)
+	if len(changes) != 1 || changes[0].Op != DiffEqual || changes[0].Sentence.Start != 5 {
+		t.Errorf("Diff with new timings = %s, want the new sentence as equal", describe(changes))
+	}
+}
+
+func TestDiffLargeMiddle(t *testing.T) {
+	// Past maxDiffCells the changed middle is not aligned sentence by
+	// sentence, only the common prefix and suffix are.
+	var from, to []string
+	from = append(from, "A:start")
+	to = append(to, "A:start")
+	for i := 0; i < 2001; i++ {
+		from = append(from, fmt.Sprintf("A:old %d", i))
+		to = append(to, fmt.Sprintf("A:new %d", i))
+	}
+	from = append(from, "A:end")
+	to = append(to, "A:end")
+
+	changes := Diff(sentences(from...), sentences(to...))
+	if len(changes) != 2+2*2001 {
+		t.Fatalf("Diff returned %d changes, want %d", len(changes), 2+2*2001)
+	}
+	for i, change := range changes {
+		want := DiffDelete
+		switch {
+		case i == 0 || i == len(changes)-1:
+			want = DiffEqual
+		case i > 2001:
+			want = DiffInsert
+		}
+		if change.Op != want {
+			t.Fatalf("change %d is %s, want %s", i, change.Op, want)
+		}
+	}
+	if last := changes[len(changes)-1]; *last.FromIndex != 2002 || *last.ToIndex != 2002 {
+		t.Errorf("last change at %d,%d, want 2002,2002", *last.FromIndex, *last.ToIndex)
+	}
+}
@@ -0,0 +1,325 @@
+package revisions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// recordAttempts bounds retries when two writers race for the same revision
+// number.
+const recordAttempts = 3
+
+func EnsureIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "conversation_id", Value: 1}, {Key: "number", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// Record stores revision as the conversation's newest revision, numbering it
+// after the current latest one.
+func Record(ctx context.Context, collection *mongo.Collection, revision models.TranscriptRevision) (*models.TranscriptRevision, error) {
+	revision.ID = primitive.NilObjectID
+	revision.CreatedAt = time.Now()
+	if revision.Transcript == nil {
+		revision.Transcript = []models.TranscriptionSentence{}
+	}
+
+	for attempt := 0; ; attempt++ {
+		latest, err := Latest(ctx, collection, revision.ConversationID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("error fetching latest transcript revision: %v", err)
+		}
+		revision.Number = 1
+		if latest != nil {
+			revision.Number = latest.Number + 1
+		}
+
+		result, err := collection.InsertOne(ctx, revision)
+		if mongo.IsDuplicateKeyError(err) && attempt+1 < recordAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error saving transcript revision: %v", err)
+		}
+		revision.ID = result.InsertedID.(primitive.ObjectID)
+		return &revision, nil
+	}
+}
+
+// Baseline records the conversation's current transcript as its first
+// revision if it has a transcript but no revisions yet, as is the case for
+// transcripts written before revisions were kept. Call it before replacing a
+// transcript so the version being replaced is never lost.
+func Baseline(ctx context.Context, collection *mongo.Collection, conversation models.Conversation) error {
+	if len(conversation.Transcript) == 0 {
+		return nil
+	}
+	count, err := collection.CountDocuments(ctx, bson.M{"conversation_id": conversation.ID}, options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("error counting transcript revisions: %v", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = Record(ctx, collection, models.TranscriptRevision{
+		ConversationID: conversation.ID,
+		UserID:         conversation.UserID,
+		Source:         models.RevisionOriginal,
+		Transcript:     conversation.Transcript,
+		Summary:        conversation.Summary,
+		ActionItems:    conversation.ActionItems,
+		Metadata:       conversation.Metadata,
+	})
+	return err
+}
+
+// Latest returns the conversation's newest revision.
+func Latest(ctx context.Context, collection *mongo.Collection, conversationID primitive.ObjectID) (*models.TranscriptRevision, error) {
+	var revision models.TranscriptRevision
+	err := collection.FindOne(ctx,
+		bson.M{"conversation_id": conversationID},
+		options.FindOne().SetSort(bson.D{{Key: "number", Value: -1}}),
+	).Decode(&revision)
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// findRevision loads one of the user's revisions of a conversation.
+func findRevision(ctx context.Context, collection *mongo.Collection, userID, conversationID primitive.ObjectID, id string) (*models.TranscriptRevision, error) {
+	revisionID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	var revision models.TranscriptRevision
+	err = collection.FindOne(ctx, bson.M{"_id": revisionID, "conversation_id": conversationID, "user_id": userID}).Decode(&revision)
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// GetRevisions lists a conversation's revisions, newest first, without their
+// transcripts.
+func GetRevisions(conversationsCollection, revisionsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var conversation models.Conversation
+		err = conversationsCollection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID}).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
+			return
+		}
+		if err := Baseline(context.TODO(), revisionsCollection, conversation); err != nil {
+			log.Printf("Error recording original transcript revision: %v", err)
+		}
+
+		cursor, err := revisionsCollection.Find(context.TODO(),
+			bson.M{"conversation_id": conversationID, "user_id": userID},
+			options.Find().SetSort(bson.D{{Key: "number", Value: -1}}).SetProjection(bson.M{"transcript": 0}),
+		)
+		if err != nil {
+			http.Error(w, "Error fetching revisions", http.StatusInternalServerError)
+			return
+		}
+		defer cursor.Close(context.TODO())
+
+		revisions := []models.TranscriptRevision{}
+		if err := cursor.All(context.TODO(), &revisions); err != nil {
+			http.Error(w, "Error decoding revisions", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(revisions)
+	}
+}
+
+// GetRevision returns one revision including its transcript.
+func GetRevision(revisionsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		revision, err := findRevision(context.TODO(), revisionsCollection, userID, conversationID, params["revision"])
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching revision", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(revision)
+	}
+}
+
+// DiffRevisions compares two revisions sentence by sentence. ?from= and ?to=
+// are revision IDs; to defaults to the latest revision.
+func DiffRevisions(revisionsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Get("from") == "" {
+			http.Error(w, "from is required", http.StatusBadRequest)
+			return
+		}
+		from, err := findRevision(context.TODO(), revisionsCollection, userID, conversationID, query.Get("from"))
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching revision", http.StatusInternalServerError)
+			return
+		}
+
+		var to *models.TranscriptRevision
+		if query.Get("to") == "" {
+			to, err = Latest(context.TODO(), revisionsCollection, conversationID)
+		} else {
+			to, err = findRevision(context.TODO(), revisionsCollection, userID, conversationID, query.Get("to"))
+		}
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching revision", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"from":    from.ID,
+			"to":      to.ID,
+			"changes": Diff(from.Transcript, to.Transcript),
+		})
+	}
+}
+
+// RestoreRevision makes an earlier revision's transcript current again. The
+// restore is itself recorded as a new revision, so it can be undone.
+func RestoreRevision(conversationsCollection, revisionsCollection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var conversation models.Conversation
+		err = conversationsCollection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil}).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
+			return
+		}
+
+		revision, err := findRevision(context.TODO(), revisionsCollection, userID, conversationID, params["revision"])
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching revision", http.StatusInternalServerError)
+			return
+		}
+
+		if err := Baseline(context.TODO(), revisionsCollection, conversation); err != nil {
+			http.Error(w, "Error saving current transcript", http.StatusInternalServerError)
+			return
+		}
+
+		set := bson.M{
+			"transcript":        revision.Transcript,
+			"summary":           revision.Summary,
+			"action_items":      revision.ActionItems,
+			"updated_at":        time.Now(),
+			"needs_action_sync": true,
+		}
+		if revision.Metadata != nil {
+			set["metadata"] = revision.Metadata
+		}
+		// Only write over the transcript that was current when the restore
+		// was asked for, not an edit made in the meantime.
+		result, err := conversationsCollection.UpdateOne(context.TODO(),
+			bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil, "updated_at": conversation.UpdatedAt},
+			bson.M{"$set": set},
+		)
+		if err != nil {
+			http.Error(w, "Error restoring transcript", http.StatusInternalServerError)
+			return
+		}
+		if result.MatchedCount == 0 {
+			http.Error(w, "Conversation was modified, reload and try again", http.StatusConflict)
+			return
+		}
+
+		restored, err := Record(context.TODO(), revisionsCollection, models.TranscriptRevision{
+			ConversationID: conversationID,
+			UserID:         userID,
+			Source:         models.RevisionRestore,
+			AuthorID:       &userID,
+			RestoredFrom:   &revision.ID,
+			Transcript:     revision.Transcript,
+			Summary:        revision.Summary,
+			ActionItems:    revision.ActionItems,
+			Metadata:       revision.Metadata,
+		})
+		if err != nil {
+			// The transcript is restored; reporting a failure would only
+			// have the client restore it again.
+			log.Printf("Error recording restored transcript revision: %v", err)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Transcript restored successfully"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(restored)
+	}
+}
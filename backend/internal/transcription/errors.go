@@ -0,0 +1,115 @@
+package transcription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrUnauthorized     = errors.New("transcription provider rejected the API key")
+	ErrQuotaExceeded    = errors.New("transcription provider quota or rate limit exceeded")
+	ErrAudioUnreachable = errors.New("transcription provider could not fetch the audio")
+	ErrTimeout          = errors.New("transcription request timed out")
+)
+
+// APIError is returned for an unsuccessful response from a provider. It wraps
+// one of the sentinel errors above when the failure is recognised, so callers
+// can use errors.Is.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s returned status %d", e.Provider, e.StatusCode)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether trying the same transcription again may succeed.
+// A rejected key or unreachable audio will fail the same way every time.
+func Retryable(err error) bool {
+	return !errors.Is(err, ErrUnauthorized) && !errors.Is(err, ErrAudioUnreachable)
+}
+
+// RetryAfter returns the delay a provider asked for before the next request,
+// or zero if it did not ask.
+func RetryAfter(err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter
+	}
+	return 0
+}
+
+// checkResponse turns a non-2xx response into an *APIError.
+func checkResponse(provider string, resp *http.Response, body []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	apiErr := &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Message:    truncate(string(body), 300),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		apiErr.Err = ErrUnauthorized
+	case http.StatusPaymentRequired, http.StatusTooManyRequests:
+		apiErr.Err = ErrQuotaExceeded
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		apiErr.Err = ErrTimeout
+	}
+	return apiErr
+}
+
+// transportError classifies an error from http.Client.Do.
+func transportError(action string, err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %s: %v", ErrTimeout, action, err)
+	}
+	return fmt.Errorf("error %s: %w", action, err)
+}
+
+// parseRetryAfter accepts both forms of the header: delay seconds and an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,88 @@
+package transcription
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+var fakeLines = []string{
+	"Thanks everyone for joining today.",
+	"Let's go over where we are with the launch.",
+	"The design review is scheduled for next week.",
+	"I will send the updated budget by Friday.",
+	"We still need someone to own the onboarding docs.",
+	"Can you follow up with the vendor about pricing?",
+	"I think we should push the beta by a few days.",
+	"Let's meet again on Thursday to check progress.",
+}
+
+// fakeProvider produces a transcript without any network access. Output
+// depends only on the audio file name, not the (expiring) signed URL, so
+// re-running a conversation yields the same transcript.
+type fakeProvider struct{}
+
+func (fakeProvider) Name() string {
+	return ProviderFake
+}
+
+func (fakeProvider) Transcribe(ctx context.Context, audioURL string, opts models.TranscriptionOptions) (*Result, error) {
+	name := audioFileName(audioURL)
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	seed := h.Sum32()
+
+	count := 3 + int(seed%4)
+	speakers := 2
+	if opts.SpeakerCount > 0 {
+		speakers = opts.SpeakerCount
+	}
+	if opts.Diarization != nil && !*opts.Diarization {
+		speakers = 1
+	}
+	sentences := make([]models.TranscriptionSentence, 0, count)
+	start := 0.0
+	for i := 0; i < count; i++ {
+		text := fakeLines[(seed+uint32(i))%uint32(len(fakeLines))]
+		sentence := models.TranscriptionSentence{
+			Sentence:   text,
+			Start:      start,
+			Speaker:    fmt.Sprint(i % speakers),
+			Confidence: 1,
+		}
+		for _, word := range strings.Fields(text) {
+			sentence.Words = append(sentence.Words, models.TranscriptionWord{
+				Word:       word,
+				Start:      start,
+				End:        start + 0.4,
+				Confidence: 1,
+			})
+			start += 0.4
+		}
+		sentence.End = start
+		sentences = append(sentences, sentence)
+		start += 0.5
+	}
+
+	analysis := make(map[string]string)
+	for _, prompt := range opts.Prompts {
+		analysis[prompt.Name] = fmt.Sprintf("Fake answer to %q for %s.", prompt.Prompt, name)
+	}
+
+	return &Result{
+		Sentences:     sentences,
+		Summary:       fmt.Sprintf("A %d sentence conversation about the upcoming launch.", count),
+		ActionItems:   []string{"Send the updated budget by Friday", "Follow up with the vendor about pricing"},
+		Title:         "Fake transcript of " + name,
+		Languages:     []string{"en"},
+		Analysis:      analysis,
+		ProviderJobID: fmt.Sprintf("fake-%08x", seed),
+		Metadata: Metadata{
+			AudioDuration: start,
+			Channels:      1,
+		},
+	}, nil
+}
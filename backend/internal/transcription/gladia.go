@@ -0,0 +1,372 @@
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	actionItemsPrompt = "Extract the key action items the transcription as bullet points"
+	titlePrompt       = "Generate a title from this transcription"
+)
+
+const (
+	gladiaV2BaseURL    = "https://api.gladia.io/v2/"
+	gladiaPollInterval = 5 * time.Second
+	gladiaPollTimeout  = 30 * time.Minute
+	// gladiaRequestTimeout bounds each HTTP call; Gladia answers both submit
+	// and poll requests immediately.
+	gladiaRequestTimeout = time.Minute
+)
+
+type TranscriptionRequest struct {
+	AudioURL            string `json:"audio_url"`
+	DiarizationEnhanced bool   `json:"diarization_enhanced"`
+	Sentences           bool   `json:"sentences"`
+	Summarization       bool   `json:"summarization"`
+	AudioToLLM          bool   `json:"audio_to_llm"`
+	AudioToLLMConfig    struct {
+		Prompts []string `json:"prompts"`
+	} `json:"audio_to_llm_config"`
+	Callback       bool            `json:"callback,omitempty"`
+	CallbackConfig *CallbackConfig `json:"callback_config,omitempty"`
+
+	Diarization            bool                    `json:"diarization,omitempty"`
+	DiarizationConfig      *DiarizationConfig      `json:"diarization_config,omitempty"`
+	LanguageConfig         *LanguageConfig         `json:"language_config,omitempty"`
+	CustomVocabulary       bool                    `json:"custom_vocabulary,omitempty"`
+	CustomVocabularyConfig *CustomVocabularyConfig `json:"custom_vocabulary_config,omitempty"`
+}
+
+type DiarizationConfig struct {
+	NumberOfSpeakers int `json:"number_of_speakers,omitempty"`
+}
+
+type LanguageConfig struct {
+	Languages     []string `json:"languages"`
+	CodeSwitching bool     `json:"code_switching"`
+}
+
+type CustomVocabularyConfig struct {
+	Vocabulary []string `json:"vocabulary"`
+}
+
+type CallbackConfig struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+}
+
+type TranscriptionResponse struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	ResultURL string `json:"result_url"`
+}
+
+type TranscriptionResult struct {
+	Status    string `json:"status"`
+	ErrorCode int    `json:"error_code"`
+	Result    struct {
+		Metadata struct {
+			AudioDuration            float64 `json:"audio_duration"`
+			NumberOfDistinctChannels int     `json:"number_of_distinct_channels"`
+			BillingTime              float64 `json:"billing_time"`
+			TranscriptionTime        float64 `json:"transcription_time"`
+		} `json:"metadata"`
+		Transcription struct {
+			Utterances     []models.TranscriptionSentence `json:"utterances"`
+			FullTranscript string                         `json:"full_transcript"`
+			Languages      []string                       `json:"languages"`
+			Sentences      []models.TranscriptionSentence `json:"sentences"`
+		} `json:"transcription"`
+		Summarization struct {
+			Success bool        `json:"success"`
+			IsEmpty bool        `json:"is_empty"`
+			Results string      `json:"results"`
+			Error   interface{} `json:"error"`
+		} `json:"summarization"`
+		AudioToLLM struct {
+			Success  bool          `json:"success"`
+			IsEmpty  bool          `json:"is_empty"`
+			Results  []LLMResponse `json:"results"`
+			ExecTime float64       `json:"exec_time"`
+			Error    interface{}   `json:"error"`
+		} `json:"audio_to_llm"`
+	} `json:"result"`
+}
+
+type LLMResponse struct {
+	Success  bool        `json:"success"`
+	IsEmpty  bool        `json:"is_empty"`
+	Results  LLMResults  `json:"results"`
+	ExecTime float64     `json:"exec_time"`
+	Error    interface{} `json:"error"`
+}
+
+type LLMResults struct {
+	Prompt   string `json:"prompt"`
+	Response string `json:"response"`
+}
+
+type gladiaProvider struct {
+	apiKey string
+	client *http.Client
+}
+
+func newGladiaProvider(apiKey string) *gladiaProvider {
+	return &gladiaProvider{apiKey: apiKey, client: &http.Client{Timeout: gladiaRequestTimeout}}
+}
+
+func (p *gladiaProvider) Name() string {
+	return ProviderGladia
+}
+
+// Transcribe submits the audio and polls for the result, giving up after
+// gladiaPollTimeout or when ctx is cancelled.
+func (p *gladiaProvider) Transcribe(ctx context.Context, audioURL string, opts models.TranscriptionOptions) (*Result, error) {
+	id, err := p.Submit(ctx, audioURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gladiaPollTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(gladiaPollInterval)
+	defer ticker.Stop()
+	for {
+		wait := ticker.C
+		result, done, err := p.Fetch(ctx, id, opts)
+		if errors.Is(err, ErrQuotaExceeded) && RetryAfter(err) > 0 {
+			// Rate limited while polling: back off as asked instead of failing.
+			wait = time.After(RetryAfter(err))
+		} else if err != nil {
+			return nil, err
+		} else if done {
+			return result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: gave up waiting for transcription %s: %v", ErrTimeout, id, ctx.Err())
+		case <-wait:
+		}
+	}
+}
+
+// Submit starts a transcription and returns Gladia's job ID. When callbackURL
+// is set Gladia POSTs to it once the job finishes.
+func (p *gladiaProvider) Submit(ctx context.Context, audioURL, callbackURL string, opts models.TranscriptionOptions) (string, error) {
+	requestData := TranscriptionRequest{
+		AudioURL:            audioURL,
+		DiarizationEnhanced: true,
+		Sentences:           true,
+		Summarization:       true,
+		AudioToLLM:          true,
+		AudioToLLMConfig: struct {
+			Prompts []string `json:"prompts"`
+		}{
+			Prompts: gladiaPrompts(opts),
+		},
+	}
+	if callbackURL != "" {
+		requestData.Callback = true
+		requestData.CallbackConfig = &CallbackConfig{URL: callbackURL, Method: "POST"}
+	}
+	if opts.Diarization != nil {
+		requestData.Diarization = *opts.Diarization
+		requestData.DiarizationEnhanced = *opts.Diarization
+	}
+	if opts.SpeakerCount > 0 && (opts.Diarization == nil || *opts.Diarization) {
+		requestData.Diarization = true
+		requestData.DiarizationConfig = &DiarizationConfig{NumberOfSpeakers: opts.SpeakerCount}
+	}
+	if opts.Language != "" {
+		requestData.LanguageConfig = &LanguageConfig{Languages: []string{opts.Language}}
+	}
+	if len(opts.CustomVocabulary) > 0 {
+		requestData.CustomVocabulary = true
+		requestData.CustomVocabularyConfig = &CustomVocabularyConfig{Vocabulary: opts.CustomVocabulary}
+	}
+
+	jsonData, err := json.Marshal(requestData)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request data: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", gladiaV2BaseURL+"transcription/", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("x-gladia-key", p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", transportError("sending request", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", transportError("reading response body", err)
+	}
+	if err := checkResponse(ProviderGladia, resp, body); err != nil {
+		return "", err
+	}
+
+	var transcriptionResp TranscriptionResponse
+	err = json.Unmarshal(body, &transcriptionResp)
+	if err != nil {
+		return "", fmt.Errorf("error unmarshaling response: %v", err)
+	}
+
+	if transcriptionResp.ID == "" {
+		return "", fmt.Errorf("no transcription ID in response")
+	}
+
+	return transcriptionResp.ID, nil
+}
+
+// Fetch checks a submitted transcription once. done is false while Gladia is
+// still processing. opts must be the options the transcription was submitted
+// with, so that prompt answers can be matched back to their names.
+func (p *gladiaProvider) Fetch(ctx context.Context, id string, opts models.TranscriptionOptions) (*Result, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", gladiaV2BaseURL+"transcription/"+id, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("error creating poll request: %v", err)
+	}
+
+	req.Header.Set("x-gladia-key", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, false, transportError("sending poll request", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, false, transportError("reading poll response body", err)
+	}
+	if err := checkResponse(ProviderGladia, resp, body); err != nil {
+		return nil, false, err
+	}
+
+	var pollResult TranscriptionResult
+	err = json.Unmarshal(body, &pollResult)
+	if err != nil {
+		return nil, false, fmt.Errorf("error unmarshaling poll response: %v", err)
+	}
+
+	switch pollResult.Status {
+	case "done":
+		result := pollResult.toResult(opts)
+		result.ProviderJobID = id
+		return result, true, nil
+	case "error":
+		return nil, false, pollResult.jobError(id)
+	default:
+		return nil, false, nil
+	}
+}
+
+// jobError describes a transcription Gladia accepted but could not finish.
+// Gladia reports client-side problems, such as an audio URL it cannot download
+// or decode, with a 4xx error code.
+func (r *TranscriptionResult) jobError(id string) error {
+	apiErr := &APIError{
+		Provider:   ProviderGladia,
+		StatusCode: r.ErrorCode,
+		Message:    "transcription " + id + " failed",
+	}
+	switch {
+	case r.ErrorCode == http.StatusUnauthorized || r.ErrorCode == http.StatusForbidden:
+		apiErr.Err = ErrUnauthorized
+	case r.ErrorCode == http.StatusPaymentRequired || r.ErrorCode == http.StatusTooManyRequests:
+		apiErr.Err = ErrQuotaExceeded
+	case r.ErrorCode >= 400 && r.ErrorCode < 500:
+		apiErr.Err = ErrAudioUnreachable
+	}
+	return apiErr
+}
+
+// gladiaPrompts lists the audio_to_llm prompts for a request: the built-in
+// action item and title prompts followed by the user's own.
+func gladiaPrompts(opts models.TranscriptionOptions) []string {
+	prompts := []string{actionItemsPrompt, titlePrompt}
+	for _, prompt := range opts.Prompts {
+		prompts = append(prompts, prompt.Prompt)
+	}
+	return prompts
+}
+
+func (r *TranscriptionResult) toResult(opts models.TranscriptionOptions) *Result {
+	sentences := r.Result.Transcription.Sentences
+	if len(sentences) == 0 {
+		sentences = r.Result.Transcription.Utterances
+	}
+
+	// Answers come back in the order the prompts were sent. The echoed prompt
+	// is only used as a fallback, since two user prompts may share a text.
+	prompts := gladiaPrompts(opts)
+	actionItems := make([]string, 0)
+	analysis := make(map[string]string)
+	var title string
+	for i, llmResponse := range r.Result.AudioToLLM.Results {
+		if !llmResponse.Success || llmResponse.IsEmpty {
+			continue
+		}
+		slot := i
+		if slot >= len(prompts) || prompts[slot] != llmResponse.Results.Prompt {
+			slot = indexOf(prompts, llmResponse.Results.Prompt)
+		}
+		response := strings.TrimSpace(llmResponse.Results.Response)
+		switch {
+		case slot == 0:
+			actionItems = append(actionItems, parseBullets(response)...)
+		case slot == 1:
+			title = cleanTitle(response)
+		case slot > 1:
+			analysis[opts.Prompts[slot-2].Name] = response
+		}
+	}
+
+	var summary string
+	if r.Result.Summarization.Success && !r.Result.Summarization.IsEmpty {
+		summary = strings.TrimSpace(r.Result.Summarization.Results)
+	}
+
+	metadata := r.Result.Metadata
+	return &Result{
+		Sentences:   sentences,
+		Summary:     summary,
+		ActionItems: actionItems,
+		Title:       title,
+		Analysis:    analysis,
+		Languages:   r.Result.Transcription.Languages,
+		Metadata: Metadata{
+			AudioDuration:     metadata.AudioDuration,
+			BillingTime:       metadata.BillingTime,
+			TranscriptionTime: metadata.TranscriptionTime,
+			Channels:          metadata.NumberOfDistinctChannels,
+		},
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
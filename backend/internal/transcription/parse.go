@@ -0,0 +1,63 @@
+package transcription
+
+import (
+	"regexp"
+	"strings"
+)
+
+var bulletPrefix = regexp.MustCompile(`^\s*(?:[-*•‣◦]|\d+[.)])\s+`)
+
+// parseBullets splits an LLM bullet list into its items. Lines that are not
+// bullets continue the previous item, and a preamble such as "Here are the
+// action items:" before the first bullet is dropped. A response with no
+// bullets at all is returned as a single item.
+func parseBullets(text string) []string {
+	items := make([]string, 0)
+	sawBullet := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if loc := bulletPrefix.FindStringIndex(line); loc != nil {
+			sawBullet = true
+			if item := cleanItem(line[loc[1]:]); item != "" {
+				items = append(items, item)
+			}
+			continue
+		}
+		if sawBullet && len(items) > 0 {
+			items[len(items)-1] += " " + cleanItem(line)
+		}
+	}
+
+	if !sawBullet {
+		if item := cleanItem(text); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// cleanItem strips markdown emphasis and checkbox markers from a bullet.
+func cleanItem(item string) string {
+	item = strings.TrimSpace(item)
+	item = strings.TrimPrefix(item, "[ ] ")
+	item = strings.TrimPrefix(item, "[x] ")
+	item = strings.ReplaceAll(item, "**", "")
+	item = strings.ReplaceAll(item, "__", "")
+	return strings.TrimSpace(item)
+}
+
+// cleanTitle reduces an LLM's title answer to the bare title, dropping
+// labels, markdown and surrounding quotes.
+func cleanTitle(text string) string {
+	title := strings.TrimSpace(strings.Split(strings.TrimSpace(text), "\n")[0])
+	title = strings.TrimLeft(title, "# ")
+	if i := strings.Index(title, ":"); i >= 0 && strings.EqualFold(strings.TrimSpace(title[:i]), "title") {
+		title = title[i+1:]
+	}
+	title = cleanItem(title)
+	title = strings.Trim(title, `"'“”*`)
+	return strings.TrimSpace(title)
+}
@@ -0,0 +1,210 @@
+package transcription
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const (
+	whisperDefaultBaseURL = "https://api.openai.com/v1"
+	whisperDefaultModel   = "whisper-1"
+	// whisperRequestTimeout covers downloading, uploading and transcribing the
+	// audio in a single synchronous request.
+	whisperRequestTimeout = 20 * time.Minute
+)
+
+// whisperProvider speaks the OpenAI /audio/transcriptions API, which is also
+// implemented by local servers such as faster-whisper-server and LocalAI.
+type whisperProvider struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+type whisperResponse struct {
+	Text     string  `json:"text"`
+	Language string  `json:"language"`
+	Duration float64 `json:"duration"`
+	Segments []struct {
+		Start      float64 `json:"start"`
+		End        float64 `json:"end"`
+		Text       string  `json:"text"`
+		AvgLogprob float64 `json:"avg_logprob"`
+	} `json:"segments"`
+	Words []struct {
+		Word  string  `json:"word"`
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+	} `json:"words"`
+}
+
+func newWhisperProvider(baseURL, apiKey, model string) *whisperProvider {
+	if baseURL == "" {
+		baseURL = whisperDefaultBaseURL
+	}
+	if model == "" {
+		model = whisperDefaultModel
+	}
+	return &whisperProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: whisperRequestTimeout},
+	}
+}
+
+func (p *whisperProvider) Name() string {
+	return ProviderWhisper
+}
+
+// Transcribe downloads the audio and re-uploads it, since the OpenAI API only
+// accepts file uploads rather than URLs. Whisper has no LLM step or
+// diarization, so analysis prompts and speaker options are ignored.
+func (p *whisperProvider) Transcribe(ctx context.Context, audioURL string, opts models.TranscriptionOptions) (*Result, error) {
+	audioReq, err := http.NewRequestWithContext(ctx, "GET", audioURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating download request: %v", err)
+	}
+	audioResp, err := p.client.Do(audioReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, transportError("downloading audio", err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrAudioUnreachable, err)
+	}
+	defer audioResp.Body.Close()
+	if audioResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: download returned status %d", ErrAudioUnreachable, audioResp.StatusCode)
+	}
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		fields := [][2]string{
+			{"model", p.model},
+			{"response_format", "verbose_json"},
+			{"timestamp_granularities[]", "segment"},
+			{"timestamp_granularities[]", "word"},
+		}
+		if opts.Language != "" {
+			fields = append(fields, [2]string{"language", opts.Language})
+		}
+		if len(opts.CustomVocabulary) > 0 {
+			// Whisper has no vocabulary option; words in the prompt bias its spelling.
+			fields = append(fields, [2]string{"prompt", strings.Join(opts.CustomVocabulary, ", ")})
+		}
+		for _, field := range fields {
+			if err := form.WriteField(field[0], field[1]); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		part, err := form.CreateFormFile("file", audioFileName(audioURL))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, audioResp.Body); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(form.Close())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/audio/transcriptions", pr)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, transportError("sending request", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, transportError("reading response body", err)
+	}
+	if err := checkResponse(ProviderWhisper, resp, body); err != nil {
+		return nil, err
+	}
+
+	var whisperResp whisperResponse
+	if err := json.Unmarshal(body, &whisperResp); err != nil {
+		return nil, fmt.Errorf("error unmarshaling response: %v", err)
+	}
+
+	return whisperResp.toResult(), nil
+}
+
+// toResult turns Whisper segments into sentences. Whisper does not diarize, so
+// every sentence is attributed to speaker "0".
+func (r *whisperResponse) toResult() *Result {
+	sentences := make([]models.TranscriptionSentence, 0, len(r.Segments))
+	for _, segment := range r.Segments {
+		sentence := models.TranscriptionSentence{
+			Sentence: strings.TrimSpace(segment.Text),
+			Start:    segment.Start,
+			End:      segment.End,
+			Speaker:  "0",
+			Words:    []models.TranscriptionWord{},
+		}
+		for _, word := range r.Words {
+			if word.Start >= segment.Start && word.Start < segment.End {
+				sentence.Words = append(sentence.Words, models.TranscriptionWord{
+					Word:  strings.TrimSpace(word.Word),
+					Start: word.Start,
+					End:   word.End,
+				})
+			}
+		}
+		sentences = append(sentences, sentence)
+	}
+	if len(sentences) == 0 && r.Text != "" {
+		sentences = append(sentences, models.TranscriptionSentence{
+			Sentence: strings.TrimSpace(r.Text),
+			End:      r.Duration,
+			Speaker:  "0",
+		})
+	}
+
+	result := &Result{
+		Sentences: sentences,
+		Metadata: Metadata{
+			AudioDuration: r.Duration,
+			Channels:      1,
+		},
+	}
+	if r.Language != "" {
+		result.Languages = []string{r.Language}
+	}
+	return result
+}
+
+func audioFileName(audioURL string) string {
+	u, err := url.Parse(audioURL)
+	if err != nil {
+		return "audio"
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return "audio"
+	}
+	return name
+}
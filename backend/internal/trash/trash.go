@@ -0,0 +1,294 @@
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/gcp"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+const defaultRetentionDays = 30
+
+// Retention is how long conversations stay in the trash before they are
+// purged, from TRASH_RETENTION_DAYS (default 30).
+func Retention() time.Duration {
+	days := defaultRetentionDays
+	if value, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && value > 0 {
+		days = value
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Purger permanently deletes conversations together with their audio object,
+// transcript revisions, embedded transcript chunks, action items and
+// detected meetings.
+type Purger struct {
+	conversations *mongo.Collection
+	revisions     *mongo.Collection
+	chunks        *mongo.Collection
+	actionItems   *mongo.Collection
+	meetings      *mongo.Collection
+	credentials   *mongo.Collection
+	SweepInterval time.Duration
+}
+
+func NewPurger(conversationsCollection, revisionsCollection, chunksCollection, actionItemsCollection, meetingsCollection, gcpCredentialsCollection *mongo.Collection) *Purger {
+	return &Purger{
+		conversations: conversationsCollection,
+		revisions:     revisionsCollection,
+		chunks:        chunksCollection,
+		actionItems:   actionItemsCollection,
+		meetings:      meetingsCollection,
+		credentials:   gcpCredentialsCollection,
+		SweepInterval: time.Hour,
+	}
+}
+
+// Purge deletes the conversation's audio from the user's bucket, then the
+// conversation and everything derived from it. The audio goes first so that a
+// failure leaves the conversation in place to be purged again, rather than an
+// object the bucket import would turn back into a conversation.
+func (p *Purger) Purge(ctx context.Context, conversation models.Conversation) error {
+	if conversation.AudioFile != nil {
+		store, _, err := gcp.OpenUserBlobStore(ctx, p.credentials, conversation.UserID)
+		if err != nil {
+			return err
+		}
+		err = store.Delete(ctx, conversation.AudioFile.Name)
+		store.Close()
+		if err != nil && !errors.Is(err, gcp.ErrObjectNotFound) {
+			return fmt.Errorf("error deleting audio object: %v", err)
+		}
+	}
+
+	if _, err := p.revisions.DeleteMany(ctx, bson.M{"conversation_id": conversation.ID}); err != nil {
+		return fmt.Errorf("error deleting transcript revisions: %v", err)
+	}
+	if _, err := p.chunks.DeleteMany(ctx, bson.M{"conversation_id": conversation.ID}); err != nil {
+		return fmt.Errorf("error deleting transcript chunks: %v", err)
+	}
+	if _, err := p.actionItems.DeleteMany(ctx, bson.M{"conversation_id": conversation.ID}); err != nil {
+		return fmt.Errorf("error deleting action items: %v", err)
+	}
+	if _, err := p.meetings.DeleteMany(ctx, bson.M{"conversation_id": conversation.ID}); err != nil {
+		return fmt.Errorf("error deleting meetings: %v", err)
+	}
+	if _, err := p.conversations.DeleteOne(ctx, bson.M{"_id": conversation.ID, "user_id": conversation.UserID}); err != nil {
+		return fmt.Errorf("error deleting conversation: %v", err)
+	}
+	return nil
+}
+
+// Run purges conversations whose trash retention has passed, every
+// SweepInterval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	for {
+		p.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.SweepInterval):
+		}
+	}
+}
+
+func (p *Purger) sweep(ctx context.Context) {
+	cursor, err := p.conversations.Find(ctx,
+		bson.M{"deleted_at": bson.M{"$lt": time.Now().Add(-Retention())}},
+		options.Find().SetProjection(bson.M{"_id": 1, "user_id": 1, "audio_file": 1}),
+	)
+	if err != nil {
+		log.Printf("Error fetching expired trash: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var conversation models.Conversation
+		if err := cursor.Decode(&conversation); err != nil {
+			log.Printf("Error decoding trashed conversation: %v", err)
+			continue
+		}
+		if err := p.Purge(ctx, conversation); err != nil {
+			log.Printf("Error purging conversation %s: %v", conversation.ID.Hex(), err)
+		}
+	}
+}
+
+// UpdateConversation changes a conversation's name, tags or summary. Fields
+// left out of the request are kept.
+func UpdateConversation(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update struct {
+			Name    *string   `json:"name"`
+			Tags    *[]string `json:"tags"`
+			Summary *string   `json:"summary"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid update", http.StatusBadRequest)
+			return
+		}
+
+		set := bson.M{"updated_at": time.Now()}
+		if update.Name != nil {
+			name := strings.TrimSpace(*update.Name)
+			if name == "" {
+				http.Error(w, "Name must not be empty", http.StatusBadRequest)
+				return
+			}
+			set["name"] = name
+		}
+		if update.Tags != nil {
+			tags := []string{}
+			seen := map[string]bool{}
+			for _, tag := range *update.Tags {
+				tag = strings.ToLower(strings.TrimSpace(tag))
+				if tag != "" && !seen[tag] {
+					seen[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+			set["tags"] = tags
+		}
+		if update.Summary != nil {
+			set["summary"] = strings.TrimSpace(*update.Summary)
+		}
+
+		var conversation models.Conversation
+		err = collection.FindOneAndUpdate(context.TODO(),
+			bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil},
+			bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error updating conversation", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+// DeleteConversation moves a conversation to the trash.
+func DeleteConversation(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		now := time.Now()
+		result, err := collection.UpdateOne(context.TODO(),
+			bson.M{"_id": conversationID, "user_id": userID, "deleted_at": nil},
+			bson.M{"$set": bson.M{"deleted_at": now}},
+		)
+		if err != nil {
+			http.Error(w, "Error deleting conversation", http.StatusInternalServerError)
+			return
+		}
+		if result.MatchedCount == 0 {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":  "Conversation moved to trash",
+			"purge_at": now.Add(Retention()),
+		})
+	}
+}
+
+// RestoreConversation takes a conversation back out of the trash.
+func RestoreConversation(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var conversation models.Conversation
+		err = collection.FindOneAndUpdate(context.TODO(),
+			bson.M{"_id": conversationID, "user_id": userID, "deleted_at": bson.M{"$ne": nil}},
+			bson.M{"$unset": bson.M{"deleted_at": ""}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found in trash", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error restoring conversation", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+// PurgeConversation permanently deletes a conversation in the trash,
+// including its audio object.
+func PurgeConversation(collection *mongo.Collection, purger *Purger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		conversationID, _ := primitive.ObjectIDFromHex(params["id"])
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var conversation models.Conversation
+		err = collection.FindOne(context.TODO(), bson.M{"_id": conversationID, "user_id": userID, "deleted_at": bson.M{"$ne": nil}}).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Conversation not found in trash", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error fetching conversation", http.StatusInternalServerError)
+			return
+		}
+
+		if err := purger.Purge(context.TODO(), conversation); err != nil {
+			log.Printf("Error purging conversation %s: %v", conversationID.Hex(), err)
+			http.Error(w, "Error purging conversation", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Conversation deleted permanently"})
+	}
+}
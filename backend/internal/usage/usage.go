@@ -0,0 +1,269 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/TheLickIn13Keys/omi-webapp/internal/auth"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/jobs"
+	"github.com/TheLickIn13Keys/omi-webapp/internal/models"
+)
+
+// Ledger records the audio each user sends to transcription providers and
+// enforces their optional monthly quota. It implements jobs.QuotaChecker.
+type Ledger struct {
+	records *mongo.Collection
+	quotas  *mongo.Collection
+}
+
+func NewLedger(recordsCollection, quotasCollection *mongo.Collection) *Ledger {
+	return &Ledger{records: recordsCollection, quotas: quotasCollection}
+}
+
+// MonthlyUsage aggregates one calendar month (UTC) of usage records.
+type MonthlyUsage struct {
+	Month          string                   `json:"month" bson:"_id"`
+	AudioSeconds   float64                  `json:"audio_seconds" bson:"audio_seconds"`
+	BillingSeconds float64                  `json:"billing_seconds" bson:"billing_seconds"`
+	Transcriptions int                      `json:"transcriptions" bson:"transcriptions"`
+	Providers      map[string]ProviderUsage `json:"providers" bson:"-"`
+}
+
+type ProviderUsage struct {
+	AudioSeconds   float64 `json:"audio_seconds"`
+	BillingSeconds float64 `json:"billing_seconds"`
+	Transcriptions int     `json:"transcriptions"`
+}
+
+func (l *Ledger) EnsureIndexes(ctx context.Context) error {
+	_, err := l.records.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "job_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "month", Value: 1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = l.quotas.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// Record adds a completed transcription to the ledger. Recording the same job
+// twice, e.g. from both a webhook and a polling fallback, keeps one entry.
+func (l *Ledger) Record(ctx context.Context, record models.UsageRecord) error {
+	record.RecordedAt = time.Now()
+	record.Month = monthOf(record.RecordedAt)
+	_, err := l.records.UpdateOne(ctx,
+		bson.M{"job_id": record.JobID},
+		bson.M{"$setOnInsert": record},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// CheckQuota reports whether the user has used up this month's quota, in
+// which case their transcriptions are held until the next month starts.
+func (l *Ledger) CheckQuota(ctx context.Context, userID primitive.ObjectID) (time.Time, bool, error) {
+	var quota models.UsageQuota
+	err := l.quotas.FindOne(ctx, bson.M{"user_id": userID}).Decode(&quota)
+	if err == mongo.ErrNoDocuments || (err == nil && quota.MonthlyAudioSeconds <= 0) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	now := time.Now()
+	months, err := l.monthly(ctx, userID, monthOf(now))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(months) == 0 || months[0].AudioSeconds < quota.MonthlyAudioSeconds {
+		return time.Time{}, false, nil
+	}
+	return startOfNextMonth(now), true, nil
+}
+
+// monthly aggregates the user's records from the given month onwards, newest
+// month first.
+func (l *Ledger) monthly(ctx context.Context, userID primitive.ObjectID, fromMonth string) ([]MonthlyUsage, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "month": bson.M{"$gte": fromMonth}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":             bson.M{"month": "$month", "provider": "$provider"},
+			"audio_seconds":   bson.M{"$sum": "$audio_seconds"},
+			"billing_seconds": bson.M{"$sum": "$billing_seconds"},
+			"transcriptions":  bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.month", Value: -1}, {Key: "_id.provider", Value: 1}}}},
+	}
+	cursor, err := l.records.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	months := []MonthlyUsage{}
+	for cursor.Next(ctx) {
+		var row struct {
+			ID struct {
+				Month    string `bson:"month"`
+				Provider string `bson:"provider"`
+			} `bson:"_id"`
+			AudioSeconds   float64 `bson:"audio_seconds"`
+			BillingSeconds float64 `bson:"billing_seconds"`
+			Transcriptions int     `bson:"transcriptions"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+
+		if len(months) == 0 || months[len(months)-1].Month != row.ID.Month {
+			months = append(months, MonthlyUsage{Month: row.ID.Month, Providers: map[string]ProviderUsage{}})
+		}
+		month := &months[len(months)-1]
+		month.AudioSeconds += row.AudioSeconds
+		month.BillingSeconds += row.BillingSeconds
+		month.Transcriptions += row.Transcriptions
+		month.Providers[row.ID.Provider] = ProviderUsage{
+			AudioSeconds:   row.AudioSeconds,
+			BillingSeconds: row.BillingSeconds,
+			Transcriptions: row.Transcriptions,
+		}
+	}
+	return months, cursor.Err()
+}
+
+func monthOf(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+func startOfNextMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// GetUsage returns per-month usage for the last ?months= months (default 12)
+// together with the user's quota, if any.
+func GetUsage(ledger *Ledger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		userID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		count := 12
+		if value := r.URL.Query().Get("months"); value != "" {
+			count, err = strconv.Atoi(value)
+			if err != nil || count < 1 || count > 120 {
+				http.Error(w, "Invalid months", http.StatusBadRequest)
+				return
+			}
+		}
+		now := time.Now().UTC()
+		from := time.Date(now.Year(), now.Month()-time.Month(count-1), 1, 0, 0, 0, 0, time.UTC)
+
+		months, err := ledger.monthly(context.TODO(), userID, monthOf(from))
+		if err != nil {
+			http.Error(w, "Error fetching usage", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{"months": months, "quota": nil}
+		var quota models.UsageQuota
+		err = ledger.quotas.FindOne(context.TODO(), bson.M{"user_id": userID}).Decode(&quota)
+		if err == nil && quota.MonthlyAudioSeconds > 0 {
+			used := 0.0
+			if len(months) > 0 && months[0].Month == monthOf(now) {
+				used = months[0].AudioSeconds
+			}
+			response["quota"] = map[string]interface{}{
+				"monthly_audio_seconds": quota.MonthlyAudioSeconds,
+				"used_audio_seconds":    used,
+				"exceeded":              used >= quota.MonthlyAudioSeconds,
+				"resets_at":             startOfNextMonth(now),
+			}
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// SetQuota sets a user's monthly quota in audio minutes; zero removes it.
+// Only admins may set quotas, so that users cannot lift their own. Jobs held
+// under the old quota are re-evaluated straight away.
+func SetQuota(ledger *Ledger, queue *jobs.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		adminID, err := auth.GetUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !auth.IsAdmin(adminID) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["user"])
+		if err != nil {
+			http.Error(w, "Invalid user", http.StatusBadRequest)
+			return
+		}
+
+		var request struct {
+			MonthlyAudioMinutes *float64 `json:"monthly_audio_minutes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.MonthlyAudioMinutes == nil {
+			http.Error(w, "monthly_audio_minutes is required", http.StatusBadRequest)
+			return
+		}
+		minutes := *request.MonthlyAudioMinutes
+		if minutes < 0 {
+			http.Error(w, "Quota must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		if minutes == 0 {
+			_, err = ledger.quotas.DeleteOne(context.TODO(), bson.M{"user_id": userID})
+		} else {
+			_, err = ledger.quotas.UpdateOne(context.TODO(),
+				bson.M{"user_id": userID},
+				bson.M{"$set": models.UsageQuota{
+					UserID:              userID,
+					MonthlyAudioSeconds: minutes * 60,
+					UpdatedAt:           time.Now(),
+				}},
+				options.Update().SetUpsert(true),
+			)
+		}
+		if err != nil {
+			http.Error(w, "Error saving quota", http.StatusInternalServerError)
+			return
+		}
+
+		if err := queue.ReleaseHeld(context.TODO(), userID); err != nil {
+			http.Error(w, "Error releasing held transcriptions", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"message": "Quota saved successfully"})
+	}
+}